@@ -18,31 +18,20 @@ package main
 import (
 	"context"
 	"flag"
-	"net/url"
-	"os"
+	"time"
 
 	"k8s.io/klog/v2"
 
+	"github.com/llm-d/llm-d-routing-sidecar/internal/config"
 	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
 	"github.com/llm-d/llm-d-routing-sidecar/internal/signals"
+	"github.com/llm-d/llm-d-routing-sidecar/internal/tracing"
 )
 
 func main() {
-	port := flag.String("port", "8000", "the port the sidecar is listening on")
-	vLLMPort := flag.String("vllm-port", "8001", "the port vLLM is listening on")
-	connector := flag.String("connector", "nixlv2", "the P/D connector being used. Either nixl, nixlv2 or lmcache")
-	prefillerUseTLS := flag.Bool("prefiller-use-tls", false, "whether to use TLS when sending requests to prefillers")
-	decoderUseTLS := flag.Bool("decoder-use-tls", false, "whether to use TLS when sending requests to the decoder")
-	prefillerInsecureSkipVerify := flag.Bool("prefiller-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to prefiller")
-	decoderInsecureSkipVerify := flag.Bool("decoder-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to decoder")
-	secureProxy := flag.Bool("secure-proxy", true, "Enables secure proxy. Defaults to true.")
-	certPath := flag.String(
-		"cert-path", "", "The path to the certificate for secure proxy. The certificate and private key files "+
-			"are assumed to be named tls.crt and tls.key, respectively. If not set, and secureProxy is enabled, "+
-			"then a self-signed certificate is used (for testing).")
-	enableSSRFProtection := flag.Bool("enable-ssrf-protection", false, "enable SSRF protection using InferencePool allowlisting")
-	inferencePoolNamespace := flag.String("inference-pool-namespace", os.Getenv("INFERENCE_POOL_NAMESPACE"), "the Kubernetes namespace to watch for InferencePool resources (defaults to INFERENCE_POOL_NAMESPACE env var)")
-	inferencePoolName := flag.String("inference-pool-name", os.Getenv("INFERENCE_POOL_NAME"), "the specific InferencePool name to watch (defaults to INFERENCE_POOL_NAME env var)")
+	configFile := flag.String("config", "", "the path of a YAML or JSON configuration file. Flags set on the command line take precedence over the file")
+	configReloadInterval := flag.Duration("config-reload-interval", 10*time.Second, "how often the configuration file is checked for changes. 0 disables reloading")
+	config.AddFlags(flag.CommandLine)
 
 	klog.InitFlags(nil)
 	flag.Parse()
@@ -53,56 +42,59 @@ func main() {
 	ctx := signals.SetupSignalHandler(context.Background())
 	logger := klog.FromContext(ctx)
 
-	if *connector != proxy.ConnectorNIXLV1 && *connector != proxy.ConnectorNIXLV2 && *connector != proxy.ConnectorLMCache {
-		logger.Info("Error: --connector must either be 'nixl', 'nixlv2' or 'lmcache'")
+	options, err := config.Load(*configFile, flag.CommandLine)
+	if err != nil {
+		logger.Info("Error: " + err.Error())
 		return
 	}
-	if *connector == proxy.ConnectorNIXLV1 {
-		logger.Info("Warning: nixl connector is deprecated and will be removed in a future release in favor of --connector=nixlv2")
+	if err := config.ApplyLogLevel(options); err != nil {
+		logger.Error(err, "failed to set log level")
 	}
-	logger.Info("p/d connector validated", "connector", connector)
 
-	// Determine namespace and pool name for SSRF protection
-	if *enableSSRFProtection {
-		if *inferencePoolNamespace == "" {
-			logger.Info("Error: --inference-pool-namespace or INFERENCE_POOL_NAMESPACE environment variable is required when --enable-ssrf-protection is true")
-			return
-		}
-		if *inferencePoolName == "" {
-			logger.Info("Error: --inference-pool-name or INFERENCE_POOL_NAME environment variable is required when --enable-ssrf-protection is true")
-			return
+	registration, _ := proxy.LookupConnector(options.Connector.Name)
+	if registration.Deprecated {
+		logger.Info("Warning: " + options.Connector.Name + " connector is deprecated and will be removed in a future release in favor of --connector=" + proxy.ConnectorNIXLV2)
+	}
+	logger.Info("p/d connector validated", "connector", options.Connector.Name)
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		logger.Error(err, "failed to set up tracing")
+		return
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error(err, "failed to shut down tracing")
 		}
+	}()
 
-		logger.Info("SSRF protection enabled", "namespace", inferencePoolNamespace, "poolName", inferencePoolName)
+	if options.SSRF.Enabled {
+		logger.Info("SSRF protection enabled", "namespace", options.SSRF.InferencePoolNamespace, "poolName", options.SSRF.InferencePoolName,
+			"allowlistFile", options.SSRF.AllowlistFile)
 	}
 
 	// start reverse proxy HTTP server
-	scheme := "http"
-	if *decoderUseTLS {
-		scheme = "https"
-	}
-	targetURL, err := url.Parse(scheme + "://localhost:" + *vLLMPort)
+	targetURL, err := options.DecoderURL()
 	if err != nil {
 		logger.Error(err, "failed to create targetURL")
 		return
 	}
 
-	config := proxy.Config{
-		Connector:                   *connector,
-		PrefillerUseTLS:             *prefillerUseTLS,
-		SecureProxy:                 *secureProxy,
-		CertPath:                    *certPath,
-		PrefillerInsecureSkipVerify: *prefillerInsecureSkipVerify,
-		DecoderInsecureSkipVerify:   *decoderInsecureSkipVerify,
-		EnableSSRFProtection:        *enableSSRFProtection,
-		InferencePoolNamespace:      *inferencePoolNamespace,
-		InferencePoolName:           *inferencePoolName,
-	}
-
-	proxy, err := proxy.NewProxy(*port, targetURL, config)
+	proxy, err := proxy.NewProxy(options.Port, targetURL, options.ProxyConfig())
 	if err != nil {
 		logger.Error(err, "Failed to create proxy")
+		return
 	}
+
+	if *configFile != "" && *configReloadInterval > 0 {
+		go config.Watch(ctx, *configFile, flag.CommandLine, options, *configReloadInterval, func(updated config.Options) error {
+			if err := proxy.Reconfigure(updated.ProxyConfig()); err != nil {
+				return err
+			}
+			return config.ApplyLogLevel(updated)
+		})
+	}
+
 	if err := proxy.Start(ctx); err != nil {
 		logger.Error(err, "failed to start proxy server")
 	}
@@ -0,0 +1,371 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the sidecar configuration from the command line flags and an optional
+// YAML or JSON configuration file, and watches the file for changes.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+)
+
+// Options is the sidecar configuration. Field names are the ones used in the configuration file.
+type Options struct {
+	// Port is the port the sidecar is listening on.
+	Port string `json:"port"`
+
+	// VLLMPort is the port vLLM is listening on.
+	VLLMPort string `json:"vllmPort"`
+
+	// MetricsPort is the port serving the Prometheus metrics. Metrics are disabled when empty.
+	MetricsPort string `json:"metricsPort"`
+
+	// LogLevel is the log verbosity. The current verbosity is kept when not set.
+	LogLevel *int `json:"logLevel,omitempty"`
+
+	Connector        ConnectorOptions `json:"connector"`
+	TLS              TLSOptions       `json:"tls"`
+	SSRF             SSRFOptions      `json:"ssrf"`
+	Timeouts         TimeoutOptions   `json:"timeouts"`
+	PrefillFallback  FallbackOptions  `json:"prefillFallback"`
+	StreamFirstToken bool             `json:"streamFirstToken"`
+
+	// MaxRequestBodySize is the maximum size, in bytes, of the completion request bodies. 0 means no limit.
+	MaxRequestBodySize int64 `json:"maxRequestBodySize"`
+
+	// DecoderProbeInterval is how often the decoder health is probed for the readiness endpoint. 0 disables the probe.
+	DecoderProbeInterval metav1.Duration `json:"decoderProbeInterval"`
+}
+
+// ConnectorOptions configures the P/D connector
+type ConnectorOptions struct {
+	Name    string    `json:"name"`
+	Options KeyValues `json:"options"`
+}
+
+// TLSOptions configures the TLS of the sidecar listener and of the outgoing requests
+type TLSOptions struct {
+	SecureProxy                 bool              `json:"secureProxy"`
+	CertPath                    string            `json:"certPath"`
+	PrefillerUseTLS             bool              `json:"prefillerUseTLS"`
+	PrefillerInsecureSkipVerify bool              `json:"prefillerInsecureSkipVerify"`
+	DecoderUseTLS               bool              `json:"decoderUseTLS"`
+	DecoderInsecureSkipVerify   bool              `json:"decoderInsecureSkipVerify"`
+	PrefillerCAFile             string            `json:"prefillerCAFile"`
+	PrefillerCertFile           string            `json:"prefillerCertFile"`
+	PrefillerKeyFile            string            `json:"prefillerKeyFile"`
+	PrefillerAllowedSANs        List              `json:"prefillerAllowedSANs"`
+	ClientCAFile                string            `json:"clientCAFile"`
+	ClientAllowedSANs           List              `json:"clientAllowedSANs"`
+	Profile                     TLSProfileOptions `json:"profile"`
+	SelfSigned                  SelfSignedOptions `json:"selfSigned"`
+}
+
+// SelfSignedOptions configures the certificate generated when the secure proxy has no certificate path
+type SelfSignedOptions struct {
+	DNSNames    List            `json:"dnsNames"`
+	IPAddresses List            `json:"ipAddresses"`
+	KeyType     string          `json:"keyType"`
+	Validity    metav1.Duration `json:"validity"`
+	CADir       string          `json:"caDir"`
+}
+
+// TLSProfileOptions configures the TLS security profile of the listener and of the outgoing requests
+type TLSProfileOptions struct {
+	Type         string `json:"type"`
+	MinVersion   string `json:"minVersion"`
+	MaxVersion   string `json:"maxVersion"`
+	CipherSuites List   `json:"cipherSuites"`
+	Curves       List   `json:"curves"`
+}
+
+// SSRFOptions configures the SSRF protection
+type SSRFOptions struct {
+	Enabled                bool            `json:"enabled"`
+	InferencePoolNamespace string          `json:"inferencePoolNamespace"`
+	InferencePoolName      string          `json:"inferencePoolName"`
+	PortSource             string          `json:"portSource"`
+	AllowedPorts           List            `json:"allowedPorts"`
+	AllowlistFile          string          `json:"allowlistFile"`
+	EndpointSliceService   string          `json:"endpointSliceService"`
+	SyncTimeout            metav1.Duration `json:"syncTimeout"`
+	SyncPolicy             string          `json:"syncPolicy"`
+}
+
+// TimeoutOptions configures the prefill and decode timeouts
+type TimeoutOptions struct {
+	PrefillConnect  metav1.Duration `json:"prefillConnect"`
+	Prefill         metav1.Duration `json:"prefill"`
+	DecodeFirstByte metav1.Duration `json:"decodeFirstByte"`
+}
+
+// FallbackOptions configures the fallback to local prefill
+type FallbackOptions struct {
+	Enabled     bool `json:"enabled"`
+	StatusCodes List `json:"statusCodes"`
+}
+
+// AddFlags registers the command line flags of the configuration options
+func AddFlags(fs *flag.FlagSet) {
+	var o Options
+	o.bindFlags(fs)
+}
+
+// bindFlags registers the command line flags, setting the options to their default values
+func (o *Options) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Port, "port", "8000", "the port the sidecar is listening on")
+	fs.StringVar(&o.VLLMPort, "vllm-port", "8001", "the port vLLM is listening on")
+	fs.StringVar(&o.MetricsPort, "metrics-port", "", "the port serving the sidecar Prometheus metrics on /metrics, e.g. 9090. Disabled when empty")
+	fs.StringVar(&o.Connector.Name, "connector", proxy.ConnectorNIXLV2, "the P/D connector being used. One of "+ConnectorsUsage())
+	o.Connector.Options = KeyValues{}
+	fs.Var(&o.Connector.Options, "connector-options", "comma-separated list of key=value options passed to the P/D connector")
+	fs.BoolVar(&o.TLS.PrefillerUseTLS, "prefiller-use-tls", false, "whether to use TLS when sending requests to prefillers")
+	fs.BoolVar(&o.TLS.DecoderUseTLS, "decoder-use-tls", false, "whether to use TLS when sending requests to the decoder")
+	fs.BoolVar(&o.TLS.PrefillerInsecureSkipVerify, "prefiller-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to prefiller")
+	fs.BoolVar(&o.TLS.DecoderInsecureSkipVerify, "decoder-tls-insecure-skip-verify", false, "configures the proxy to skip TLS verification for requests to decoder")
+	fs.StringVar(&o.TLS.PrefillerCAFile, "prefiller-tls-ca-file", "", "the path of the PEM CA bundle verifying the prefiller certificates. The system roots are used when empty")
+	fs.StringVar(&o.TLS.PrefillerCertFile, "prefiller-tls-cert-file", "", "the path of the client certificate presented to prefillers")
+	fs.StringVar(&o.TLS.PrefillerKeyFile, "prefiller-tls-key-file", "", "the path of the key of the client certificate presented to prefillers")
+	fs.Var(&o.TLS.PrefillerAllowedSANs, "prefiller-tls-allowed-sans", "comma-separated list of DNS, IP or URI (e.g. SPIFFE ID) SANs allowed in the prefiller certificates. "+
+		"When set, the prefiller host name is not verified")
+	fs.StringVar(&o.TLS.ClientCAFile, "client-tls-ca-file", "", "the path of the PEM CA bundle verifying the client certificates. When set, requests without a valid client certificate "+
+		"are rejected, except on the health endpoints")
+	fs.Var(&o.TLS.ClientAllowedSANs, "client-tls-allowed-sans", "comma-separated list of DNS, IP or URI (e.g. SPIFFE ID) SANs allowed in the client certificates")
+	fs.StringVar(&o.TLS.Profile.Type, "tls-profile", proxy.TLSProfileIntermediate, "the TLS security profile of the listener and of the requests to the decoder and prefillers. One of "+
+		proxy.TLSProfileOld+", "+proxy.TLSProfileIntermediate+", "+proxy.TLSProfileModern+", "+proxy.TLSProfileFIPS+" or "+proxy.TLSProfileCustom)
+	fs.StringVar(&o.TLS.Profile.MinVersion, "tls-min-version", "", "the minimum TLS version of the Custom TLS profile, e.g. VersionTLS12")
+	fs.StringVar(&o.TLS.Profile.MaxVersion, "tls-max-version", "", "the maximum TLS version of the Custom TLS profile, e.g. VersionTLS13")
+	fs.Var(&o.TLS.Profile.CipherSuites, "tls-cipher-suites", "comma-separated list of the IANA names of the TLS 1.2 cipher suites of the Custom TLS profile")
+	fs.Var(&o.TLS.Profile.Curves, "tls-curves", "comma-separated list of the key exchange curves of the Custom TLS profile, e.g. X25519,CurveP256")
+	fs.BoolVar(&o.TLS.SecureProxy, "secure-proxy", true, "Enables secure proxy. Defaults to true.")
+	fs.StringVar(&o.TLS.CertPath,
+		"cert-path", "", "The path to the certificate for secure proxy. The certificate and private key files "+
+			"are assumed to be named tls.crt and tls.key, respectively. If not set, and secureProxy is enabled, "+
+			"then a self-signed certificate is used (for testing).")
+	fs.Var(&o.TLS.SelfSigned.DNSNames, "self-signed-dns-names", "comma-separated list of the DNS SANs of the self-signed certificate. Defaults to the host name and localhost, "+
+		"unless --self-signed-ips is set")
+	fs.Var(&o.TLS.SelfSigned.IPAddresses, "self-signed-ips", "comma-separated list of the IP SANs of the self-signed certificate. Defaults to the IPs of the network interfaces, "+
+		"unless --self-signed-dns-names is set")
+	fs.StringVar(&o.TLS.SelfSigned.KeyType, "self-signed-key-type", proxy.KeyTypeRSA, "the key type of the self-signed certificate: "+proxy.KeyTypeRSA+" (4096 bits) or "+
+		proxy.KeyTypeECDSA+" (P-256, faster to generate)")
+	fs.DurationVar(&o.TLS.SelfSigned.Validity.Duration, "self-signed-validity", 30*24*time.Hour, "the validity of the self-signed certificate, which is renewed when a third of it remains")
+	fs.StringVar(&o.TLS.SelfSigned.CADir, "self-signed-ca-dir", "", "the directory of the CA issuing the self-signed certificate, in ca.crt and ca.key. The CA is generated there "+
+		"when missing, so that peers can trust it. The certificate is self-signed when empty")
+	fs.BoolVar(&o.SSRF.Enabled, "enable-ssrf-protection", false, "enable SSRF protection using InferencePool allowlisting")
+	fs.StringVar(&o.SSRF.InferencePoolNamespace, "inference-pool-namespace", os.Getenv("INFERENCE_POOL_NAMESPACE"), "the Kubernetes namespace to watch for InferencePool resources (defaults to INFERENCE_POOL_NAMESPACE env var)")
+	fs.StringVar(&o.SSRF.InferencePoolName, "inference-pool-name", os.Getenv("INFERENCE_POOL_NAME"), "the specific InferencePool name to watch (defaults to INFERENCE_POOL_NAME env var)")
+	fs.StringVar(&o.SSRF.PortSource, "ssrf-port-source", proxy.PortSourceTargetPort, "where the ports allowed on the InferencePool pods come from. One of "+
+		proxy.PortSourceTargetPort+" (the InferencePool target port), "+proxy.PortSourceContainerPorts+" (the ports declared by the pod containers) or "+proxy.PortSourceAny)
+	fs.Var(&o.SSRF.AllowedPorts, "ssrf-allowed-ports", "comma-separated list of additional ports allowed on the InferencePool pods")
+	fs.StringVar(&o.SSRF.AllowlistFile, "ssrf-allowlist-file", "", "the path of a file listing the allowed prefill hostnames, IPs and CIDRs, optionally with a port. "+
+		"Combined with the InferencePool allowlist when --inference-pool-name is set")
+	fs.StringVar(&o.SSRF.EndpointSliceService, "ssrf-endpoint-slice-service", "", "the name of a Service selecting the InferencePool pods. "+
+		"When set, the ready endpoints of its EndpointSlices are allowed instead of watching the pool pods")
+	fs.DurationVar(&o.SSRF.SyncTimeout.Duration, "ssrf-sync-timeout", 30*time.Second, "how long to wait at startup for the InferencePool allowlist to sync before serving requests. 0 means no wait")
+	fs.StringVar(&o.SSRF.SyncPolicy, "ssrf-sync-policy", proxy.AllowlistSyncFailClosed, "whether prefill targets are rejected ("+proxy.AllowlistSyncFailClosed+
+		") or allowed ("+proxy.AllowlistSyncFailOpen+") while the InferencePool allowlist is syncing")
+	fs.DurationVar(&o.Timeouts.PrefillConnect.Duration, "prefill-connect-timeout", 10*time.Second, "the timeout for connecting to a prefiller, including the TLS handshake. 0 means no timeout")
+	fs.DurationVar(&o.Timeouts.Prefill.Duration, "prefill-timeout", 0, "the timeout for a prefill request, per attempt. 0 means no timeout")
+	fs.DurationVar(&o.Timeouts.DecodeFirstByte.Duration, "decode-first-byte-timeout", 0, "the timeout for receiving the decoder response headers. 0 means no timeout")
+	fs.Int64Var(&o.MaxRequestBodySize, "max-request-body-size", 0, "the maximum size, in bytes, of the completion request bodies. Larger requests are rejected with 413. 0 means no limit")
+	fs.DurationVar(&o.DecoderProbeInterval.Duration, "decoder-probe-interval", 5*time.Second, "how often the decoder /health endpoint is probed for the /ready endpoint. 0 disables the probe")
+	fs.BoolVar(&o.StreamFirstToken, "stream-first-token", false, "stream the prefiller first token to streaming clients while the decoder warms up (greedy or seeded sampling only)")
+	fs.BoolVar(&o.PrefillFallback.Enabled, "prefill-fallback", false, "fall back to local prefill on the decoder when the prefiller fails")
+	o.PrefillFallback.StatusCodes = List{"5xx"}
+	fs.Var(&o.PrefillFallback.StatusCodes, "prefill-fallback-status-codes", "comma-separated list of prefiller status codes (e.g. 503) or classes (e.g. 5xx) triggering a fallback to local prefill")
+}
+
+// Validate checks the options are consistent
+func (o Options) Validate() error {
+	if _, err := proxy.NewConnector(o.Connector.Name, o.Connector.Options); err != nil {
+		return err
+	}
+	if (o.TLS.PrefillerCertFile == "") != (o.TLS.PrefillerKeyFile == "") {
+		return errors.New("--prefiller-tls-cert-file and --prefiller-tls-key-file must be set together")
+	}
+	if o.TLS.ClientCAFile != "" && !o.TLS.SecureProxy {
+		return errors.New("--client-tls-ca-file requires --secure-proxy")
+	}
+	if len(o.TLS.ClientAllowedSANs) > 0 && o.TLS.ClientCAFile == "" {
+		return errors.New("--client-tls-allowed-sans requires --client-tls-ca-file")
+	}
+	if err := o.ProxyConfig().TLSProfile.Validate(); err != nil {
+		return err
+	}
+	if err := o.ProxyConfig().SelfSignedCert.Validate(); err != nil {
+		return fmt.Errorf("invalid self-signed certificate options: %w", err)
+	}
+	if o.SSRF.Enabled {
+		if err := o.ProxyConfig().AllowlistPorts.Validate(); err != nil {
+			return fmt.Errorf("invalid SSRF protection ports: %w", err)
+		}
+		if o.SSRF.InferencePoolName == "" && o.SSRF.AllowlistFile == "" {
+			return errors.New("--inference-pool-name or INFERENCE_POOL_NAME environment variable is required when --enable-ssrf-protection is true and no --ssrf-allowlist-file is set")
+		}
+		if o.SSRF.InferencePoolName != "" && o.SSRF.InferencePoolNamespace == "" {
+			return errors.New("--inference-pool-namespace or INFERENCE_POOL_NAMESPACE environment variable is required when --enable-ssrf-protection is true")
+		}
+		switch o.SSRF.SyncPolicy {
+		case "", proxy.AllowlistSyncFailClosed, proxy.AllowlistSyncFailOpen:
+		default:
+			return fmt.Errorf("invalid SSRF protection sync policy %q: expecting %s or %s", o.SSRF.SyncPolicy, proxy.AllowlistSyncFailClosed, proxy.AllowlistSyncFailOpen)
+		}
+	}
+	if o.MaxRequestBodySize < 0 {
+		return fmt.Errorf("maxRequestBodySize must be positive, got %d", o.MaxRequestBodySize)
+	}
+	if o.LogLevel != nil && *o.LogLevel < 0 {
+		return fmt.Errorf("logLevel must be positive, got %d", *o.LogLevel)
+	}
+	return o.ProxyConfig().PrefillFallback.Validate()
+}
+
+// DecoderURL returns the URL of the local decoder
+func (o Options) DecoderURL() (*url.URL, error) {
+	scheme := "http"
+	if o.TLS.DecoderUseTLS {
+		scheme = "https"
+	}
+	return url.Parse(scheme + "://localhost:" + o.VLLMPort)
+}
+
+// ProxyConfig returns the proxy configuration
+func (o Options) ProxyConfig() proxy.Config {
+	return proxy.Config{
+		Connector:                   o.Connector.Name,
+		ConnectorOptions:            o.Connector.Options,
+		MetricsPort:                 o.MetricsPort,
+		PrefillerUseTLS:             o.TLS.PrefillerUseTLS,
+		SecureProxy:                 o.TLS.SecureProxy,
+		CertPath:                    o.TLS.CertPath,
+		PrefillerInsecureSkipVerify: o.TLS.PrefillerInsecureSkipVerify,
+		DecoderInsecureSkipVerify:   o.TLS.DecoderInsecureSkipVerify,
+		PrefillerCAFile:             o.TLS.PrefillerCAFile,
+		PrefillerCertFile:           o.TLS.PrefillerCertFile,
+		PrefillerKeyFile:            o.TLS.PrefillerKeyFile,
+		PrefillerAllowedSANs:        o.TLS.PrefillerAllowedSANs,
+		ClientCAFile:                o.TLS.ClientCAFile,
+		ClientAllowedSANs:           o.TLS.ClientAllowedSANs,
+		SelfSignedCert: proxy.SelfSignedCertConfig{
+			DNSNames:    o.TLS.SelfSigned.DNSNames,
+			IPAddresses: o.TLS.SelfSigned.IPAddresses,
+			KeyType:     o.TLS.SelfSigned.KeyType,
+			Validity:    o.TLS.SelfSigned.Validity.Duration,
+			CADir:       o.TLS.SelfSigned.CADir,
+		},
+		TLSProfile: proxy.TLSProfile{
+			Type:         o.TLS.Profile.Type,
+			MinVersion:   o.TLS.Profile.MinVersion,
+			MaxVersion:   o.TLS.Profile.MaxVersion,
+			CipherSuites: o.TLS.Profile.CipherSuites,
+			Curves:       o.TLS.Profile.Curves,
+		},
+		EnableSSRFProtection:   o.SSRF.Enabled,
+		InferencePoolNamespace: o.SSRF.InferencePoolNamespace,
+		InferencePoolName:      o.SSRF.InferencePoolName,
+		AllowlistPorts: proxy.PortPolicy{
+			Source: o.SSRF.PortSource,
+			Ports:  o.SSRF.AllowedPorts,
+		},
+		AllowlistFile:                 o.SSRF.AllowlistFile,
+		AllowlistEndpointSliceService: o.SSRF.EndpointSliceService,
+		AllowlistSyncTimeout:          o.SSRF.SyncTimeout.Duration,
+		AllowlistSyncPolicy:           o.SSRF.SyncPolicy,
+		PrefillConnectTimeout:         o.Timeouts.PrefillConnect.Duration,
+		PrefillTimeout:                o.Timeouts.Prefill.Duration,
+		DecodeFirstByteTimeout:        o.Timeouts.DecodeFirstByte.Duration,
+		StreamFirstToken:              o.StreamFirstToken,
+		MaxRequestBodySize:            o.MaxRequestBodySize,
+		DecoderProbeInterval:          o.DecoderProbeInterval.Duration,
+		PrefillFallback: proxy.FallbackPolicy{
+			Enabled:     o.PrefillFallback.Enabled,
+			StatusCodes: o.PrefillFallback.StatusCodes,
+		},
+	}
+}
+
+// ConnectorsUsage lists the registered connectors for flag help and error messages
+func ConnectorsUsage() string {
+	names := proxy.RegisteredConnectors()
+	for i, name := range names {
+		if registration, _ := proxy.LookupConnector(name); registration.Deprecated {
+			names[i] = name + " (deprecated)"
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// KeyValues is a set of options, set on the command line as a comma-separated list of key=value pairs
+type KeyValues map[string]string
+
+func (kv *KeyValues) String() string {
+	if kv == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*kv))
+	for key, value := range *kv {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a comma-separated list of key=value pairs
+func (kv *KeyValues) Set(value string) error {
+	options := KeyValues{}
+	if value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			options[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	*kv = options
+	return nil
+}
+
+// List is a list of values, set on the command line as a comma-separated list
+type List []string
+
+func (l *List) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// Set parses a comma-separated list
+func (l *List) Set(value string) error {
+	if value == "" {
+		*l = nil
+		return nil
+	}
+	*l = strings.Split(value, ",")
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+)
+
+var _ = Describe("Configuration", func() {
+	newFlagSet := func(args ...string) *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		AddFlags(fs)
+		Expect(fs.Parse(args)).To(Succeed())
+		return fs
+	}
+
+	It("should use the flag defaults without configuration file", func() {
+		o, err := load(nil, newFlagSet())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.Port).To(Equal("8000"))
+		Expect(o.MetricsPort).To(BeEmpty())
+		Expect(o.Connector.Name).To(Equal(proxy.ConnectorNIXLV2))
+		Expect(o.TLS.SecureProxy).To(BeTrue())
+		Expect(o.TLS.Profile.Type).To(Equal(proxy.TLSProfileIntermediate))
+		Expect(o.Timeouts.PrefillConnect.Duration).To(Equal(10 * time.Second))
+		Expect(o.PrefillFallback.StatusCodes).To(Equal(List{"5xx"}))
+		Expect(o.LogLevel).To(BeNil())
+	})
+
+	It("should override the file values with the flags set on the command line", func() {
+		data := []byte(`
+port: "9000"
+logLevel: 3
+connector:
+  name: nixlv2
+  options:
+    abort-path: /abort
+tls:
+  secureProxy: false
+  prefillerUseTLS: true
+timeouts:
+  prefill: 30s
+prefillFallback:
+  enabled: true
+  statusCodes: ["503"]
+`)
+		o, err := load(data, newFlagSet("-port", "7000", "-prefill-timeout", "5s", "-connector-options", "abort-path=/release"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.Port).To(Equal("7000"))
+		Expect(*o.LogLevel).To(Equal(3))
+		Expect(o.Connector.Options).To(Equal(KeyValues{"abort-path": "/release"}))
+		Expect(o.TLS.SecureProxy).To(BeFalse())
+		Expect(o.TLS.PrefillerUseTLS).To(BeTrue())
+		Expect(o.Timeouts.Prefill.Duration).To(Equal(5 * time.Second))
+
+		config := o.ProxyConfig()
+		Expect(config.PrefillFallback.Enabled).To(BeTrue())
+		Expect(config.PrefillFallback.StatusCodes).To(Equal([]string{"503"}))
+	})
+
+	It("should accept JSON configuration files", func() {
+		o, err := load([]byte(`{"streamFirstToken": true, "ssrf": {"enabled": true, "inferencePoolNamespace": "ns", "inferencePoolName": "pool"}}`), newFlagSet())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.StreamFirstToken).To(BeTrue())
+		Expect(o.SSRF.InferencePoolName).To(Equal("pool"))
+	})
+
+	It("should reject invalid configuration files", func() {
+		_, err := load([]byte(`unknownField: true`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("unknownField")))
+
+		_, err = load([]byte(`connector: {name: unknown}`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("unknown connector")))
+
+		_, err = load([]byte(`prefillFallback: {statusCodes: ["abc"]}`), newFlagSet())
+		Expect(err).To(HaveOccurred())
+
+		_, err = load([]byte(`ssrf: {enabled: true}`), newFlagSet("-inference-pool-namespace", "", "-inference-pool-name", ""))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should configure the maximum request body size", func() {
+		o, err := load([]byte(`maxRequestBodySize: 1048576`), newFlagSet())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().MaxRequestBodySize).To(BeNumerically("==", 1<<20))
+
+		_, err = load(nil, newFlagSet("-max-request-body-size", "-1"))
+		Expect(err).To(MatchError(ContainSubstring("maxRequestBodySize")))
+	})
+
+	It("should not require an InferencePool with an allowlist file", func() {
+		o, err := load([]byte(`ssrf: {enabled: true, allowlistFile: /etc/allowlist}`), newFlagSet("-inference-pool-namespace", "", "-inference-pool-name", ""))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().AllowlistFile).To(Equal("/etc/allowlist"))
+
+		_, err = load([]byte(`ssrf: {enabled: true, allowlistFile: /etc/allowlist, inferencePoolName: pool}`), newFlagSet("-inference-pool-namespace", ""))
+		Expect(err).To(MatchError(ContainSubstring("--inference-pool-namespace")))
+	})
+
+	It("should validate the mutual TLS options", func() {
+		o, err := load([]byte(`tls: {prefillerCertFile: /certs/tls.crt, prefillerKeyFile: /certs/tls.key, prefillerAllowedSANs: ["spiffe://cluster.local/ns/default/sa/prefill"]}`), newFlagSet())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().PrefillerAllowedSANs).To(Equal([]string{"spiffe://cluster.local/ns/default/sa/prefill"}))
+
+		_, err = load([]byte(`tls: {prefillerCertFile: /certs/tls.crt}`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("must be set together")))
+
+		_, err = load([]byte(`tls: {secureProxy: false, clientCAFile: /certs/ca.crt}`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("requires --secure-proxy")))
+
+		_, err = load([]byte(`tls: {clientAllowedSANs: [gateway]}`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("requires --client-tls-ca-file")))
+	})
+
+	It("should configure the TLS profile", func() {
+		o, err := load([]byte(`tls: {profile: {type: Custom, minVersion: VersionTLS12, cipherSuites: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]}}`), newFlagSet("-tls-curves", "X25519,CurveP256"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().TLSProfile).To(Equal(proxy.TLSProfile{
+			Type:         proxy.TLSProfileCustom,
+			MinVersion:   "VersionTLS12",
+			CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			Curves:       []string{"X25519", "CurveP256"},
+		}))
+
+		_, err = load(nil, newFlagSet("-tls-profile", "Strict"))
+		Expect(err).To(MatchError(ContainSubstring("invalid TLS profile")))
+
+		_, err = load(nil, newFlagSet("-tls-min-version", "VersionTLS13"))
+		Expect(err).To(MatchError(ContainSubstring("Custom profile")))
+	})
+
+	It("should configure the self-signed certificate", func() {
+		o, err := load([]byte(`tls: {selfSigned: {dnsNames: [decode], keyType: ecdsa, validity: 24h, caDir: /var/run/ca}}`), newFlagSet("-self-signed-ips", "10.0.0.1"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().SelfSignedCert).To(Equal(proxy.SelfSignedCertConfig{
+			DNSNames:    []string{"decode"},
+			IPAddresses: []string{"10.0.0.1"},
+			KeyType:     proxy.KeyTypeECDSA,
+			Validity:    24 * time.Hour,
+			CADir:       "/var/run/ca",
+		}))
+
+		_, err = load(nil, newFlagSet("-self-signed-key-type", "dsa"))
+		Expect(err).To(MatchError(ContainSubstring("key type")))
+	})
+
+	It("should configure the SSRF protection sync", func() {
+		o, err := load([]byte(`ssrf: {enabled: true, allowlistFile: /etc/allowlist, syncTimeout: 1m, syncPolicy: fail-open}`), newFlagSet())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(o.ProxyConfig().AllowlistSyncTimeout).To(Equal(time.Minute))
+		Expect(o.ProxyConfig().AllowlistSyncPolicy).To(Equal("fail-open"))
+
+		_, err = load([]byte(`ssrf: {enabled: true, allowlistFile: /etc/allowlist, syncPolicy: unknown}`), newFlagSet())
+		Expect(err).To(MatchError(ContainSubstring("sync policy")))
+	})
+
+	It("should apply valid changes of the configuration file and reject the others", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte("streamFirstToken: false\n"), 0o600)).To(Succeed())
+
+		fs := newFlagSet()
+		current, err := Load(path, fs)
+		Expect(err).ToNot(HaveOccurred())
+
+		var (
+			mu      sync.Mutex
+			applied []Options
+		)
+		go Watch(ctx, path, fs, current, 10*time.Millisecond, func(o Options) error {
+			mu.Lock()
+			defer mu.Unlock()
+			applied = append(applied, o)
+			return nil
+		})
+		appliedOptions := func() []Options {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]Options(nil), applied...)
+		}
+
+		Expect(os.WriteFile(path, []byte("streamFirstToken: true\n"), 0o600)).To(Succeed())
+		Eventually(appliedOptions).Should(HaveLen(1))
+		Expect(appliedOptions()[0].StreamFirstToken).To(BeTrue())
+
+		// invalid, or requiring a restart
+		Expect(os.WriteFile(path, []byte("streamFirstToken: 1\n"), 0o600)).To(Succeed())
+		Consistently(appliedOptions, 100*time.Millisecond).Should(HaveLen(1))
+		Expect(os.WriteFile(path, []byte("streamFirstToken: true\nport: \"9000\"\n"), 0o600)).To(Succeed())
+		Consistently(appliedOptions, 100*time.Millisecond).Should(HaveLen(1))
+
+		Expect(os.WriteFile(path, []byte("streamFirstToken: true\ntls: {prefillerInsecureSkipVerify: true}\n"), 0o600)).To(Succeed())
+		Eventually(appliedOptions).Should(HaveLen(2))
+		Expect(appliedOptions()[1].TLS.PrefillerInsecureSkipVerify).To(BeTrue())
+	})
+
+	It("should log the difference of an invalid configuration file", func() {
+		logger := ktesting.NewLogger(GinkgoT(), ktesting.NewConfig(ktesting.BufferLogs(true)))
+		ctx, cancelFn := context.WithCancel(klog.NewContext(context.Background(), logger))
+		DeferCleanup(cancelFn)
+
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte("maxRequestBodySize: 1024\n"), 0o600)).To(Succeed())
+
+		fs := newFlagSet()
+		current, err := Load(path, fs)
+		Expect(err).ToNot(HaveOccurred())
+
+		go Watch(ctx, path, fs, current, 10*time.Millisecond, func(o Options) error {
+			defer GinkgoRecover()
+			Fail("an invalid configuration was applied")
+			return nil
+		})
+
+		Expect(os.WriteFile(path, []byte("maxRequestBodySize: -1\n"), 0o600)).To(Succeed())
+		rejection := func() []any {
+			for _, entry := range logger.GetSink().(ktesting.Underlier).GetBuffer().Data() {
+				if entry.Message == "rejected configuration reload" {
+					return entry.ParameterKVList
+				}
+			}
+			return nil
+		}
+		Eventually(rejection).Should(HaveLen(2))
+		Expect(rejection()[0]).To(Equal("diff"))
+		Expect(rejection()[1]).To(And(ContainSubstring("MaxRequestBodySize"), ContainSubstring("-1")))
+	})
+})
@@ -0,0 +1,171 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// logLevelFlag is the klog verbosity flag
+const logLevelFlag = "v"
+
+// Load returns the options set, in increasing order of precedence, by the flag defaults, the
+// configuration file, when path is not empty, and the flags explicitly set on the command line fs.
+func Load(path string, fs *flag.FlagSet) (Options, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return Options{}, err
+		}
+	}
+	return load(data, fs)
+}
+
+func load(data []byte, fs *flag.FlagSet) (Options, error) {
+	o, err := parse(data, fs)
+	if err != nil {
+		return Options{}, err
+	}
+	if err := o.Validate(); err != nil {
+		return Options{}, err
+	}
+	return o, nil
+}
+
+// parse returns the options set by the flag defaults, the configuration file data and the flags
+// explicitly set on fs, without validating them
+func parse(data []byte, fs *flag.FlagSet) (Options, error) {
+	var o Options
+	defaults := flag.NewFlagSet("defaults", flag.ContinueOnError)
+	o.bindFlags(defaults)
+
+	if err := yaml.UnmarshalStrict(data, &o); err != nil {
+		return Options{}, fmt.Errorf("invalid configuration file: %w", err)
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == logLevelFlag {
+			if level, perr := strconv.Atoi(f.Value.String()); perr == nil {
+				o.LogLevel = &level
+			}
+			return
+		}
+		if defaults.Lookup(f.Name) == nil {
+			return
+		}
+		if serr := defaults.Set(f.Name, f.Value.String()); serr != nil && err == nil {
+			err = fmt.Errorf("invalid --%s: %w", f.Name, serr)
+		}
+	})
+	if err != nil {
+		return Options{}, err
+	}
+	return o, nil
+}
+
+// ApplyLogLevel sets the klog verbosity to the configured log level, if any
+func ApplyLogLevel(o Options) error {
+	if o.LogLevel == nil {
+		return nil
+	}
+	f := flag.Lookup(logLevelFlag)
+	if f == nil {
+		return fmt.Errorf("klog flags are not registered")
+	}
+	return f.Value.Set(strconv.Itoa(*o.LogLevel))
+}
+
+// Watch checks the configuration file for changes every interval, until ctx is done.
+//
+// A changed configuration is passed to apply, unless it is invalid or changes options requiring a restart
+// (the ports and the decoder scheme). Rejected configurations are logged with their difference with the
+// current one, which is kept.
+func Watch(ctx context.Context, path string, fs *flag.FlagSet, current Options, interval time.Duration, apply func(Options) error) {
+	logger := klog.FromContext(ctx).WithValues("path", path)
+
+	var last []byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error(err, "failed to read configuration file")
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		updated, err := parse(data, fs)
+		if err != nil {
+			logger.Error(err, "rejected configuration reload")
+			continue
+		}
+
+		diff := cmp.Diff(current, updated)
+		if diff == "" {
+			continue
+		}
+		if err := updated.Validate(); err != nil {
+			logger.Error(err, "rejected configuration reload", "diff", diff)
+			continue
+		}
+		if err := checkReload(current, updated); err != nil {
+			logger.Error(err, "rejected configuration reload", "diff", diff)
+			continue
+		}
+		if err := apply(updated); err != nil {
+			logger.Error(err, "rejected configuration reload", "diff", diff)
+			continue
+		}
+		logger.Info("configuration reloaded", "diff", diff)
+		current = updated
+	}
+}
+
+// checkReload returns an error when the updated options change the options handled outside of the proxy
+// configuration, which require a restart
+func checkReload(current, updated Options) error {
+	switch {
+	case current.Port != updated.Port:
+		return fmt.Errorf("changing port requires a restart")
+	case current.VLLMPort != updated.VLLMPort:
+		return fmt.Errorf("changing vllmPort requires a restart")
+	case current.TLS.DecoderUseTLS != updated.TLS.DecoderUseTLS:
+		return fmt.Errorf("changing tls.decoderUseTLS requires a restart")
+	}
+	return nil
+}
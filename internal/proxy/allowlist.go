@@ -18,9 +18,16 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -30,6 +37,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
@@ -38,43 +46,158 @@ import (
 )
 
 const (
-	inferencePoolGroup    = "inference.networking.x-k8s.io"
-	inferencePoolVersion  = "v1alpha2"
+	// PortSourceTargetPort allows the InferencePool target port on the pool pods
+	PortSourceTargetPort = "target-port"
+
+	// PortSourceContainerPorts allows the ports declared by the containers of the pool pods
+	PortSourceContainerPorts = "container-ports"
+
+	// PortSourceAny allows any port on the pool pods
+	PortSourceAny = "any"
+)
+
+const (
+	// AllowlistSyncFailClosed rejects the prefill targets not allowed by the allowlist file while the
+	// InferencePool allowlist is syncing
+	AllowlistSyncFailClosed = "fail-closed"
+
+	// AllowlistSyncFailOpen allows all the prefill targets while the InferencePool allowlist is syncing
+	AllowlistSyncFailOpen = "fail-open"
+)
+
+// PortPolicy configures the ports allowed on the pods of the InferencePool
+type PortPolicy struct {
+	// Source is where the allowed ports come from: PortSourceTargetPort (the default),
+	// PortSourceContainerPorts or PortSourceAny.
+	Source string
+
+	// Ports lists additional ports allowed on every pod of the InferencePool.
+	Ports []string
+}
+
+// Validate checks the port source and ports are valid
+func (p PortPolicy) Validate() error {
+	switch p.Source {
+	case "", PortSourceTargetPort, PortSourceContainerPorts, PortSourceAny:
+	default:
+		return fmt.Errorf("invalid port source %q: expecting one of %s, %s or %s", p.Source, PortSourceTargetPort, PortSourceContainerPorts, PortSourceAny)
+	}
+	for _, port := range p.Ports {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+const (
 	inferencePoolResource = "inferencepools"
 	resyncPeriod          = 30 * time.Second
 )
 
+var podsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// inferencePoolGVRs lists the supported InferencePool API versions, in order of preference
+var inferencePoolGVRs = []schema.GroupVersionResource{
+	{Group: "inference.networking.k8s.io", Version: "v1", Resource: inferencePoolResource},
+	{Group: "inference.networking.x-k8s.io", Version: "v1alpha2", Resource: inferencePoolResource},
+}
+
 // AllowlistValidator manages allowed prefill targets based on InferencePool resources
 type AllowlistValidator struct {
-	logger        logr.Logger
-	dynamicClient dynamic.Interface
-	namespace     string
-	poolName      string
-	enabled       bool
-
-	// allowedTargets maps hostport -> bool for allowed prefill targets
-	allowedTargets   set.Set[string]
+	logger               logr.Logger
+	dynamicClient        dynamic.Interface
+	discoveryClient      discovery.DiscoveryInterface
+	poolGVR              schema.GroupVersionResource // the served InferencePool API version
+	namespace            string
+	poolName             string
+	endpointSliceService string // when set, the pool endpoints are read from the EndpointSlices of this Service
+	enabled              bool
+	portPolicy           PortPolicy
+	syncTimeout          time.Duration // how long Start waits for the allowlist to sync
+	syncPolicy           string        // AllowlistSyncFailClosed or AllowlistSyncFailOpen
+	synced               atomic.Bool   // set once the allowlist synced
+
+	// allowedTargets maps the allowed hosts to their allowed ports. A nil set allows any port.
+	allowedTargets map[string]set.Set[string]
+	// endpoints maps the pool pods and EndpointSlices, keyed by pool/name, to the ports allowed on their hosts
+	endpoints map[string]map[string]set.Set[string]
+	// hostEndpoints maps the allowed hosts to the keys of the endpoints allowing them
+	hostEndpoints    map[string]set.Set[string]
 	allowedTargetsMu sync.RWMutex
 
+	// file is the allowlist loaded from a file, nil when no allowlist file is configured
+	file *fileAllowlist
+
 	// watchers for cleanup
-	poolInformer   cache.SharedInformer
-	podInformers   map[string]cache.SharedInformer
-	podStopChans   map[string]chan struct{} // individual stop channels for pod informers
-	podInformersMu sync.RWMutex
-	stopCh         chan struct{}
+	poolInformer      cache.SharedInformer
+	poolSynced        cache.InformerSynced
+	informerSynced    map[string]cache.InformerSynced // InferencePool name -> endpoint handler synced
+	poolTargetPorts   map[string]set.Set[string]      // InferencePool name -> target ports
+	poolSelectors     map[string]string               // InferencePool name -> pod selector
+	poolGenerations   map[string]int                  // InferencePool name -> endpoint informer generation
+	informers         map[string]cache.SharedInformer
+	informerStopChans map[string]chan struct{} // individual stop channels for the pod or EndpointSlice informers
+	informersMu       sync.RWMutex
+	stopCh            chan struct{}
 }
 
-// NewAllowlistValidator creates a new SSRF protection validator
-func NewAllowlistValidator(enabled bool, namespace string, poolName string) (*AllowlistValidator, error) {
-	if !enabled {
+// NewAllowlistValidator creates a new SSRF protection validator. The allowed targets are the pods of
+// the named InferencePool and the entries of the allowlist file; either can be left empty.
+func NewAllowlistValidator(config Config) (*AllowlistValidator, error) {
+	if !config.EnableSSRFProtection {
 		return &AllowlistValidator{
 			enabled: false,
 		}, nil
 	}
 
+	portPolicy := config.AllowlistPorts
+	if err := portPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if portPolicy.Source == "" {
+		portPolicy.Source = PortSourceTargetPort
+	}
+
+	syncPolicy := config.AllowlistSyncPolicy
+	switch syncPolicy {
+	case "":
+		syncPolicy = AllowlistSyncFailClosed
+	case AllowlistSyncFailClosed, AllowlistSyncFailOpen:
+	default:
+		return nil, fmt.Errorf("invalid allowlist sync policy %q: expecting %s or %s", syncPolicy, AllowlistSyncFailClosed, AllowlistSyncFailOpen)
+	}
+
+	av := &AllowlistValidator{
+		enabled:              true,
+		namespace:            config.InferencePoolNamespace,
+		poolName:             config.InferencePoolName,
+		endpointSliceService: config.AllowlistEndpointSliceService,
+		portPolicy:           portPolicy,
+		syncTimeout:          config.AllowlistSyncTimeout,
+		syncPolicy:           syncPolicy,
+		allowedTargets:       make(map[string]set.Set[string]),
+		endpoints:            make(map[string]map[string]set.Set[string]),
+		hostEndpoints:        make(map[string]set.Set[string]),
+		poolTargetPorts:      make(map[string]set.Set[string]),
+		poolSelectors:        make(map[string]string),
+		poolGenerations:      make(map[string]int),
+		informers:            make(map[string]cache.SharedInformer),
+		informerSynced:       make(map[string]cache.InformerSynced),
+		informerStopChans:    make(map[string]chan struct{}),
+		stopCh:               make(chan struct{}),
+	}
+	if config.AllowlistFile != "" {
+		av.file = newFileAllowlist(config.AllowlistFile)
+	}
+	if av.poolName == "" {
+		// file only mode, no need for Kubernetes
+		return av, nil
+	}
+
 	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
 	overrides := &clientcmd.ConfigOverrides{}
-	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		loadingRules,
 		overrides,
 	).ClientConfig()
@@ -82,38 +205,49 @@ func NewAllowlistValidator(enabled bool, namespace string, poolName string) (*Al
 		return nil, fmt.Errorf("failed to get Kubernetes config (ensure running in a pod with proper RBAC): %w", err)
 	}
 
-	dynamicClient, err := dynamic.NewForConfig(config)
+	av.dynamicClient, err = dynamic.NewForConfig(restConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
 	}
 
-	return &AllowlistValidator{
-		enabled:        true,
-		dynamicClient:  dynamicClient,
-		namespace:      namespace,
-		poolName:       poolName,
-		allowedTargets: set.New[string](),
-		podInformers:   make(map[string]cache.SharedInformer),
-		podStopChans:   make(map[string]chan struct{}),
-		stopCh:         make(chan struct{}),
-	}, nil
+	av.discoveryClient, err = discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes discovery client: %w", err)
+	}
+
+	return av, nil
 }
 
-// Start begins watching InferencePool resources and managing the allowlist
+// Start loads the allowlist file and begins watching InferencePool resources and managing the allowlist
 func (av *AllowlistValidator) Start(ctx context.Context) error {
 	if !av.enabled {
 		return nil
 	}
 
 	av.logger = klog.FromContext(ctx).WithName("allowlist-validator")
-	av.logger.Info("starting SSRF protection allowlist validator", "namespace", av.namespace, "poolName", av.poolName)
 
-	gvr := schema.GroupVersionResource{
-		Group:    inferencePoolGroup,
-		Version:  inferencePoolVersion,
-		Resource: inferencePoolResource,
+	if av.file != nil {
+		av.file.logger = av.logger.WithName("file")
+		if err := av.file.load(); err != nil {
+			return fmt.Errorf("failed to load allowlist file: %w", err)
+		}
+		go av.file.watch(av.stopCh, allowlistFileReloadInterval)
+	}
+	if av.poolName == "" {
+		av.logger.Info("allowlist validator started successfully", "file", av.file.path)
+		return nil
 	}
 
+	av.logger.Info("starting SSRF protection allowlist validator", "namespace", av.namespace, "poolName", av.poolName,
+		"endpointSliceService", av.endpointSliceService, "portSource", av.portPolicy.Source, "ports", av.portPolicy.Ports)
+
+	gvr, err := av.detectInferencePoolGVR()
+	if err != nil {
+		return err
+	}
+	av.poolGVR = gvr
+	av.logger.Info("watching InferencePool", "apiVersion", gvr.GroupVersion().String())
+
 	// Create informer for the specific InferencePool resource
 	lw := &cache.ListWatch{
 		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
@@ -131,24 +265,76 @@ func (av *AllowlistValidator) Start(ctx context.Context) error {
 	av.poolInformer = cache.NewSharedInformer(lw, &unstructured.Unstructured{}, resyncPeriod)
 
 	// Add event handlers
-	_, _ = av.poolInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	registration, err := av.poolInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    av.onInferencePoolAdd,
 		UpdateFunc: av.onInferencePoolUpdate,
 		DeleteFunc: av.onInferencePoolDelete,
 	})
+	if err != nil {
+		return err
+	}
+	av.poolSynced = registration.HasSynced
 
 	// Start the informer
 	go av.poolInformer.Run(av.stopCh)
 
-	// Wait for cache sync
-	if !cache.WaitForCacheSync(av.stopCh, av.poolInformer.HasSynced) {
-		return fmt.Errorf("failed to sync InferencePool cache within timeout (check RBAC permissions for inferencepools.%s and that pool '%s' exists)", inferencePoolGroup, av.poolName)
+	// Wait for the InferencePool and its endpoints to sync
+	if av.syncTimeout > 0 {
+		syncCtx, cancel := context.WithTimeout(ctx, av.syncTimeout)
+		defer cancel()
+		if !cache.WaitForCacheSync(syncCtx.Done(), av.Synced) {
+			av.logger.Info("warning: the allowlist did not sync within the timeout, syncing in the background "+
+				"(check RBAC permissions and that the InferencePool exists)", "timeout", av.syncTimeout,
+				"resource", gvr.GroupResource().String(), "poolName", av.poolName, "syncPolicy", av.syncPolicy)
+			return nil
+		}
 	}
 
 	av.logger.Info("allowlist validator started successfully")
 	return nil
 }
 
+// Synced returns true once the InferencePool and the endpoints of the pool are listed. It
+// always returns true when SSRF protection is disabled or the InferencePool is not watched.
+func (av *AllowlistValidator) Synced() bool {
+	if !av.enabled || av.poolName == "" || av.synced.Load() {
+		return true
+	}
+	if av.poolSynced == nil || !av.poolSynced() {
+		return false
+	}
+
+	av.informersMu.RLock()
+	defer av.informersMu.RUnlock()
+	for _, synced := range av.informerSynced {
+		if !synced() {
+			return false
+		}
+	}
+
+	av.synced.Store(true)
+	return true
+}
+
+// detectInferencePoolGVR returns the preferred InferencePool API version served by the cluster
+func (av *AllowlistValidator) detectInferencePoolGVR() (schema.GroupVersionResource, error) {
+	var errs []error
+	for _, gvr := range inferencePoolGVRs {
+		resources, err := av.discoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == gvr.Resource {
+				return gvr, nil
+			}
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("no supported InferencePool API version is served (supported: %v): %w",
+		inferencePoolGVRs, errors.Join(errs...))
+}
+
 // Stop stops all watchers and cleans up resources
 func (av *AllowlistValidator) Stop() {
 	if !av.enabled {
@@ -157,51 +343,110 @@ func (av *AllowlistValidator) Stop() {
 
 	av.logger.Info("stopping allowlist validator")
 
-	// Stop all pod informers first
-	av.podInformersMu.Lock()
-	for poolName, stopCh := range av.podStopChans {
-		av.logger.V(4).Info("stopping pod informer", "pool", poolName)
+	// Stop all pod or EndpointSlice informers first
+	av.informersMu.Lock()
+	for poolName, stopCh := range av.informerStopChans {
+		av.logger.V(4).Info("stopping endpoint informer", "pool", poolName)
 		close(stopCh)
 	}
 	// Clear the maps
-	av.podStopChans = make(map[string]chan struct{})
-	av.podInformers = make(map[string]cache.SharedInformer)
-	av.podInformersMu.Unlock()
+	av.informerStopChans = make(map[string]chan struct{})
+	av.informers = make(map[string]cache.SharedInformer)
+	av.informerSynced = make(map[string]cache.InformerSynced)
+	av.informersMu.Unlock()
 
 	// Stop the main pool informer
 	close(av.stopCh)
 }
 
-// IsAllowed checks if a given host:port combination is in the allowlist
-func (av *AllowlistValidator) IsAllowed(hostPort string) bool {
+// IsAllowed checks if a given host:port combination is in the allowlist.
+// Targets without port are only allowed when any port is allowed on the host.
+// The decision is logged with the logger of ctx, which carries the request ID.
+func (av *AllowlistValidator) IsAllowed(ctx context.Context, hostPort string) bool {
 	if !av.enabled {
 		// If SSRF protection is disabled, allow all requests (backward compatibility)
 		return true
 	}
 
 	// Clean up the hostPort input
-	hostPort = av.normalizeHostPort(hostPort)
+	host, port := av.normalizeHostPort(hostPort)
+
+	logger := klog.FromContext(ctx)
+	if av.syncPolicy == AllowlistSyncFailOpen && !av.Synced() {
+		logger.V(4).Info("allowlist not synced, allowing target", "host", host, "port", port)
+		return true
+	}
+
+	// resolve hostnames outside of the lock, only when the InferencePool pods do not allow the target
+	allowed := av.isPoolTarget(host, port)
+	if !allowed && av.file != nil {
+		allowed = av.file.isAllowed(ctx, host, port)
+	}
+	logger.V(4).Info("allowlist check", "host", host, "port", port, "allowed", allowed)
+	return allowed
+}
+
+// errTargetNotAllowed is returned when dialing a prefiller address which is not in the allowlist
+var errTargetNotAllowed = errors.New("prefill target not allowed by SSRF protection")
 
+// dialControl returns a net.Dialer ControlContext function checking the addresses actually dialed, so that a
+// prefiller hostname resolving to another address after IsAllowed (DNS rebinding) is not reached.
+// It returns nil when SSRF protection is disabled.
+func (av *AllowlistValidator) dialControl() func(ctx context.Context, network, address string, c syscall.RawConn) error {
+	if !av.enabled {
+		return nil
+	}
+	return func(ctx context.Context, _, address string, _ syscall.RawConn) error {
+		if !av.isAddressAllowed(ctx, address) {
+			return fmt.Errorf("%w: %s", errTargetNotAllowed, address)
+		}
+		return nil
+	}
+}
+
+// isAddressAllowed checks if a resolved ip:port address is in the allowlist
+func (av *AllowlistValidator) isAddressAllowed(ctx context.Context, address string) bool {
+	if av.syncPolicy == AllowlistSyncFailOpen && !av.Synced() {
+		return true
+	}
+
+	host, port := av.normalizeHostPort(address)
+	allowed := av.isPoolTarget(host, port)
+	if !allowed && av.file != nil {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			allowed = av.file.allows(addr.Unmap(), port)
+		}
+	}
+	if !allowed {
+		klog.FromContext(ctx).Error(nil, "SSRF protection: dialed prefill address not in allowlist", "address", address)
+	}
+	return allowed
+}
+
+// isPoolTarget returns true when the host is an InferencePool pod allowed on the given port
+func (av *AllowlistValidator) isPoolTarget(host, port string) bool {
 	av.allowedTargetsMu.RLock()
 	defer av.allowedTargetsMu.RUnlock()
 
-	allowed := av.allowedTargets.Has(hostPort)
-	av.logger.V(4).Info("allowlist check", "hostPort", hostPort, "allowed", allowed)
+	ports, allowed := av.allowedTargets[host]
+	if allowed && ports != nil {
+		allowed = port != "" && ports.Has(port)
+	}
 	return allowed
 }
 
-// normalizeHostPort extracts the host part from a host:port string
-func (av *AllowlistValidator) normalizeHostPort(hostPort string) string {
+// normalizeHostPort splits a host:port string. The port is empty when the input has no port.
+func (av *AllowlistValidator) normalizeHostPort(hostPort string) (string, string) {
 	// Use net.SplitHostPort to handle IPv6 addresses and ports
-	host, _, err := net.SplitHostPort(hostPort)
+	host, port, err := net.SplitHostPort(hostPort)
 	if err != nil {
 		// If net.SplitHostPort fails, it's likely just a hostname without port
 		av.logger.V(5).Info("could not parse host:port, treating as hostname",
 			"input", hostPort,
 			"error", err.Error())
-		return hostPort
+		return hostPort, ""
 	}
-	return host
+	return host, port
 }
 
 // onInferencePoolAdd handles new InferencePool resources
@@ -224,20 +469,16 @@ func (av *AllowlistValidator) onInferencePoolDelete(obj interface{}) {
 	poolName := pool.GetName()
 	av.logger.Info("InferencePool deleted", "name", poolName)
 
-	// Stop watching pods for this pool
-	av.podInformersMu.Lock()
-	if stopCh, exists := av.podStopChans[poolName]; exists {
-		close(stopCh) // properly stop the informer
-		delete(av.podStopChans, poolName)
-	}
-	delete(av.podInformers, poolName)
-	av.podInformersMu.Unlock()
-
-	// Remove targets associated with this pool (simplified - removes all and rebuilds)
-	av.rebuildAllowlist()
+	// Stop watching the endpoints of this pool and remove them from the allowlist
+	av.informersMu.Lock()
+	defer av.informersMu.Unlock()
+	av.stopEndpointInformer(poolName)
+	av.removePoolEndpoints(poolName, "")
+	delete(av.poolTargetPorts, poolName)
+	delete(av.poolSelectors, poolName)
 }
 
-// updatePodsForPool starts or updates pod watching for a specific InferencePool
+// updatePodsForPool starts or updates the endpoint watching for a specific InferencePool
 func (av *AllowlistValidator) updatePodsForPool(poolObj *unstructured.Unstructured) {
 	poolName := poolObj.GetName()
 
@@ -248,139 +489,337 @@ func (av *AllowlistValidator) updatePodsForPool(poolObj *unstructured.Unstructur
 		return
 	}
 
-	selectorData, found, err := unstructured.NestedMap(spec, "selector")
-	if err != nil || !found {
-		av.logger.Error(err, "InferencePool missing or invalid selector field", "name", poolName, "found", found)
+	selector, err := poolSelector(spec)
+	if err != nil {
+		av.logger.Error(err, "InferencePool missing or invalid selector field", "name", poolName)
 		return
 	}
 
-	// Convert to labels.Selector
-	labelSelector := labels.Set{}
-	for k, v := range selectorData {
-		labelSelector[k] = fmt.Sprintf("%v", v)
+	targetPorts := poolTargetPorts(spec)
+	if targetPorts.Len() == 0 && av.portPolicy.Source == PortSourceTargetPort {
+		av.logger.Info("warning: InferencePool has no target port, its pods are only allowed on the explicitly allowed ports", "name", poolName)
 	}
 
-	// Create or update pod informer for this selector
-	av.createPodInformer(poolName, labelSelector.AsSelector())
+	// Create or update the endpoint informer for this selector
+	av.createEndpointInformer(poolName, selector, targetPorts)
 }
 
-// createPodInformer creates a new pod informer for the given selector
-func (av *AllowlistValidator) createPodInformer(poolName string, selector labels.Selector) {
-	av.podInformersMu.Lock()
-	defer av.podInformersMu.Unlock()
+// poolSelector returns the pod selector of an InferencePool spec. The selector is either a
+// LabelSelector (v1) or a map of labels (v1alpha2).
+func poolSelector(spec map[string]any) (labels.Selector, error) {
+	selectorData, found, err := unstructured.NestedMap(spec, "selector")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("missing selector")
+	}
+
+	var labelSelector metav1.LabelSelector
+	_, hasMatchLabels := selectorData["matchLabels"]
+	_, hasMatchExpressions := selectorData["matchExpressions"]
+	if hasMatchLabels || hasMatchExpressions {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorData, &labelSelector); err != nil {
+			return nil, err
+		}
+	} else {
+		labelSelector.MatchLabels = make(map[string]string, len(selectorData))
+		for k, v := range selectorData {
+			value, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value for selector label %q: %v", k, v)
+			}
+			labelSelector.MatchLabels[k] = value
+		}
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if selector.Empty() {
+		return nil, errors.New("empty selector")
+	}
+	return selector, nil
+}
 
-	// Stop existing informer if it exists
-	if _, exists := av.podInformers[poolName]; exists {
-		if stopCh, stopExists := av.podStopChans[poolName]; stopExists {
-			close(stopCh) // stop the existing informer
-			delete(av.podStopChans, poolName)
+// poolTargetPorts returns the target ports of an InferencePool spec: the targetPorts numbers (v1),
+// or the targetPortNumber (v1alpha2).
+func poolTargetPorts(spec map[string]any) set.Set[string] {
+	ports := set.New[string]()
+	targetPorts, _, _ := unstructured.NestedSlice(spec, "targetPorts")
+	for _, p := range targetPorts {
+		targetPort, _ := p.(map[string]any)
+		if port, ok := portString(targetPort["number"]); ok {
+			ports.Insert(port)
 		}
-		delete(av.podInformers, poolName)
+	}
+	if targetPort, found, err := unstructured.NestedFieldNoCopy(spec, "targetPortNumber"); err == nil && found {
+		if port, ok := portString(targetPort); ok {
+			ports.Insert(port)
+		}
+	}
+	return ports
+}
+
+// createEndpointInformer creates a new informer for the endpoints of the pool: the pods matching
+// the selector, or the EndpointSlices of the configured Service. The current informer is kept when
+// the selector and target ports are unchanged, e.g. on the periodic InferencePool resync.
+func (av *AllowlistValidator) createEndpointInformer(poolName string, selector labels.Selector, targetPorts set.Set[string]) {
+	av.informersMu.Lock()
+	defer av.informersMu.Unlock()
+
+	if _, running := av.informers[poolName]; running && av.poolSelectors[poolName] == selector.String() &&
+		av.poolTargetPorts[poolName].Equal(targetPorts) {
+		return
+	}
+	av.poolTargetPorts[poolName] = targetPorts
+	av.poolSelectors[poolName] = selector.String()
+
+	// Stop the existing informer. Its endpoints, which may no longer match, stay allowed until the
+	// new informer synced, so that prefill requests are not rejected while it lists the endpoints.
+	av.stopEndpointInformer(poolName)
+	av.poolGenerations[poolName]++
+	prefix := fmt.Sprintf("%s/%d/", poolName, av.poolGenerations[poolName])
+
+	gvr, labelSelector, endpointHosts := podsGVR, selector.String(), av.podHosts
+	if av.endpointSliceService != "" {
+		gvr, labelSelector, endpointHosts = endpointSlicesGVR, endpointSliceServiceLabel+"="+av.endpointSliceService, av.endpointSliceHosts
 	}
 
-	// Create new pod informer
-	podLW := &cache.ListWatch{
+	lw := &cache.ListWatch{
 		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-			options.LabelSelector = selector.String()
-			return av.dynamicClient.Resource(schema.GroupVersionResource{
-				Group:    "",
-				Version:  "v1",
-				Resource: "pods",
-			}).Namespace(av.namespace).List(context.TODO(), options)
+			options.LabelSelector = labelSelector
+			return av.dynamicClient.Resource(gvr).Namespace(av.namespace).List(context.TODO(), options)
 		},
 		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-			options.LabelSelector = selector.String()
-			return av.dynamicClient.Resource(schema.GroupVersionResource{
-				Group:    "",
-				Version:  "v1",
-				Resource: "pods",
-			}).Namespace(av.namespace).Watch(context.TODO(), options)
+			options.LabelSelector = labelSelector
+			return av.dynamicClient.Resource(gvr).Namespace(av.namespace).Watch(context.TODO(), options)
 		},
 	}
 
-	podInformer := cache.NewSharedInformer(podLW, &unstructured.Unstructured{}, resyncPeriod)
+	informer := cache.NewSharedInformer(lw, &unstructured.Unstructured{}, resyncPeriod)
+
+	// Create individual stop channel for this informer
+	stopCh := make(chan struct{})
 
 	// Add event handlers
-	_, _ = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    av.onPodAdd,
-		UpdateFunc: av.onPodUpdate,
-		DeleteFunc: av.onPodDelete,
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			av.onEndpointEvent(poolName, prefix, stopCh, obj, endpointHosts)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			av.onEndpointEvent(poolName, prefix, stopCh, newObj, endpointHosts)
+		},
+		DeleteFunc: func(obj interface{}) {
+			av.onEndpointEvent(poolName, prefix, stopCh, obj, nil)
+		},
 	})
+	if err != nil {
+		av.logger.Error(err, "failed to add endpoint event handler", "pool", poolName)
+		return
+	}
 
-	// Create individual stop channel for this informer
-	podStopCh := make(chan struct{})
-
-	av.podInformers[poolName] = podInformer
-	av.podStopChans[poolName] = podStopCh
+	av.informers[poolName] = informer
+	av.informerSynced[poolName] = registration.HasSynced
+	av.informerStopChans[poolName] = stopCh
 
 	// Start the informer with its own stop channel
-	go podInformer.Run(podStopCh)
+	go informer.Run(stopCh)
+	go av.removePreviousEndpoints(poolName, prefix, stopCh, registration.HasSynced)
 }
 
-// onPodAdd handles new pods matching our selectors
-func (av *AllowlistValidator) onPodAdd(obj interface{}) {
-	pod := obj.(*unstructured.Unstructured)
-	podIP, _, _ := unstructured.NestedString(pod.Object, "status", "podIP")
-	av.logger.V(4).Info("Pod added", "name", pod.GetName(), "ip", podIP)
-	av.rebuildAllowlist()
+// removePreviousEndpoints removes the endpoints of the previous informers of the pool from the allowlist
+// once the informer with the given stop channel and endpoint key prefix synced
+func (av *AllowlistValidator) removePreviousEndpoints(poolName, prefix string, stopCh chan struct{}, synced cache.InformerSynced) {
+	if !cache.WaitForCacheSync(stopCh, synced) {
+		return
+	}
+
+	av.informersMu.Lock()
+	defer av.informersMu.Unlock()
+	if av.informerStopChans[poolName] != stopCh {
+		// replaced or stopped in the meantime
+		return
+	}
+	av.removePoolEndpoints(poolName, prefix)
 }
 
-// onPodUpdate handles updated pods
-func (av *AllowlistValidator) onPodUpdate(_, newObj interface{}) {
-	pod := newObj.(*unstructured.Unstructured)
-	podIP, _, _ := unstructured.NestedString(pod.Object, "status", "podIP")
-	av.logger.V(4).Info("Pod updated", "name", pod.GetName(), "ip", podIP)
-	av.rebuildAllowlist()
+// stopEndpointInformer stops the endpoint informer of the pool. The caller must hold informersMu.
+func (av *AllowlistValidator) stopEndpointInformer(poolName string) {
+	if stopCh, exists := av.informerStopChans[poolName]; exists {
+		close(stopCh) // properly stop the informer
+		delete(av.informerStopChans, poolName)
+	}
+	delete(av.informers, poolName)
+	delete(av.informerSynced, poolName)
 }
 
-// onPodDelete handles deleted pods
-func (av *AllowlistValidator) onPodDelete(obj interface{}) {
-	pod := obj.(*unstructured.Unstructured)
-	av.logger.V(4).Info("Pod deleted", "name", pod.GetName())
-	av.rebuildAllowlist()
+// removePoolEndpoints removes the endpoints of the pool from the allowlist, except the ones whose key has
+// the given prefix. All the endpoints are removed when the prefix is empty. The caller must hold informersMu.
+func (av *AllowlistValidator) removePoolEndpoints(poolName, keep string) {
+	av.allowedTargetsMu.Lock()
+	defer av.allowedTargetsMu.Unlock()
+	for key := range av.endpoints {
+		if strings.HasPrefix(key, poolName+"/") && (keep == "" || !strings.HasPrefix(key, keep)) {
+			av.setEndpoint(key, nil)
+		}
+	}
 }
 
-// rebuildAllowlist rebuilds the entire allowlist from current pod state
-func (av *AllowlistValidator) rebuildAllowlist() {
+// onEndpointEvent updates the allowlist with a pod or EndpointSlice of the pool, keyed with the given
+// prefix. The endpoint is removed when endpointHosts is nil. Events from stopped informers are ignored.
+func (av *AllowlistValidator) onEndpointEvent(poolName, prefix string, stopCh chan struct{}, obj interface{},
+	endpointHosts func(*unstructured.Unstructured, string) map[string]set.Set[string]) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	endpoint, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	av.informersMu.RLock()
+	defer av.informersMu.RUnlock()
+	if av.informerStopChans[poolName] != stopCh {
+		return
+	}
+
+	var hosts map[string]set.Set[string]
+	if endpointHosts != nil {
+		hosts = endpointHosts(endpoint, poolName)
+	}
+
 	av.allowedTargetsMu.Lock()
 	defer av.allowedTargetsMu.Unlock()
+	av.setEndpoint(prefix+endpoint.GetName(), hosts)
+}
 
-	// Clear existing allowlist
-	av.allowedTargets = set.New[string]()
+// setEndpoint replaces the hosts allowed by an endpoint, and updates the ports allowed on the added and
+// removed hosts only. Nil hosts remove the endpoint. The caller must hold allowedTargetsMu.
+func (av *AllowlistValidator) setEndpoint(key string, hosts map[string]set.Set[string]) {
+	previous := av.endpoints[key]
+	if len(previous) == 0 && len(hosts) == 0 || reflect.DeepEqual(previous, hosts) {
+		return
+	}
 
-	av.podInformersMu.RLock()
-	defer av.podInformersMu.RUnlock()
-	// Rebuild from all pod informers
-	for poolName, informer := range av.podInformers {
-		store := informer.GetStore()
-		for _, obj := range store.List() {
-			pod := obj.(*unstructured.Unstructured)
+	if av.allowedTargets == nil {
+		av.allowedTargets = make(map[string]set.Set[string])
+	}
+	if av.endpoints == nil {
+		av.endpoints = make(map[string]map[string]set.Set[string])
+	}
+	if av.hostEndpoints == nil {
+		av.hostEndpoints = make(map[string]set.Set[string])
+	}
 
-			// Get pod phase and IP
-			podIP, _, _ := unstructured.NestedString(pod.Object, "status", "podIP")
+	if len(hosts) == 0 {
+		delete(av.endpoints, key)
+	} else {
+		av.endpoints[key] = hosts
+	}
 
-			// Only include pods with valid IPs
-			if podIP != "" {
-				// Add both IP and hostname variants
-				av.addPodToAllowlist(pod, poolName)
-			}
+	for host := range previous {
+		if _, exists := hosts[host]; !exists {
+			av.hostEndpoints[host].Delete(key)
+			av.updateHost(host)
+		}
+	}
+	for host := range hosts {
+		if av.hostEndpoints[host] == nil {
+			av.hostEndpoints[host] = set.New[string]()
 		}
+		av.hostEndpoints[host].Insert(key)
+		av.updateHost(host)
 	}
 
-	av.logger.Info("rebuilt allowlist", "targetCount", len(av.allowedTargets), "targets", av.allowedTargets)
+	av.logger.V(4).Info("updated allowlist", "endpoint", key, "hosts", hosts, "targetCount", len(av.allowedTargets))
+}
+
+// updateHost recomputes the ports allowed on a host from the endpoints allowing it
+func (av *AllowlistValidator) updateHost(host string) {
+	delete(av.allowedTargets, host)
+	keys := av.hostEndpoints[host]
+	if keys.Len() == 0 {
+		delete(av.hostEndpoints, host)
+		return
+	}
+	for key := range keys {
+		av.allowHost(host, av.endpoints[key][host])
+	}
 }
 
-// addPodToAllowlist adds a pod's endpoints to the allowlist
-func (av *AllowlistValidator) addPodToAllowlist(pod *unstructured.Unstructured, poolName string) {
+// podHosts returns the IP and name of a Ready pod, mapped to the ports allowed on the pod
+func (av *AllowlistValidator) podHosts(pod *unstructured.Unstructured, poolName string) map[string]set.Set[string] {
 	podIP, _, _ := unstructured.NestedString(pod.Object, "status", "podIP")
-	if podIP != "" {
-		av.allowedTargets.Insert(podIP)
+	if podIP == "" || pod.GetDeletionTimestamp() != nil || !podReady(pod) {
+		return nil
+	}
+
+	ports := av.allowedPorts(pod, poolName)
+	hosts := map[string]set.Set[string]{podIP: ports}
+	if podName := pod.GetName(); podName != "" {
+		hosts[podName] = ports
+	}
+	return hosts
+}
+
+// podReady returns true when the pod Ready condition is true
+func podReady(pod *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]any)
+		if condition["type"] == "Ready" {
+			return condition["status"] == "True"
+		}
 	}
+	return false
+}
 
-	podName := pod.GetName()
-	if podName != "" {
-		av.allowedTargets.Insert(podName)
+// allowHost adds the ports to the ports allowed on the host. A nil set allows any port.
+func (av *AllowlistValidator) allowHost(host string, ports set.Set[string]) {
+	current, exists := av.allowedTargets[host]
+	switch {
+	case !exists:
+		av.allowedTargets[host] = ports
+	case current == nil || ports == nil:
+		av.allowedTargets[host] = nil
+	default:
+		av.allowedTargets[host] = current.Union(ports)
 	}
+}
 
-	av.logger.V(5).Info("added pod to allowlist", "pod", podName, "ip", podIP, "pool", poolName)
+// allowedPorts returns the ports allowed on a pod of the pool, or nil when any port is allowed
+func (av *AllowlistValidator) allowedPorts(pod *unstructured.Unstructured, poolName string) set.Set[string] {
+	ports := set.New(av.portPolicy.Ports...)
+	switch av.portPolicy.Source {
+	case PortSourceAny:
+		return nil
+	case PortSourceContainerPorts:
+		containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+		for _, c := range containers {
+			container, _ := c.(map[string]any)
+			containerPorts, _, _ := unstructured.NestedSlice(container, "ports")
+			for _, p := range containerPorts {
+				containerPort, _ := p.(map[string]any)
+				if port, ok := portString(containerPort["containerPort"]); ok {
+					ports.Insert(port)
+				}
+			}
+		}
+	default:
+		ports = ports.Union(av.poolTargetPorts[poolName])
+	}
+	return ports
+}
+
+// portString converts a port number decoded from an unstructured object to a string
+func portString(value any) (string, bool) {
+	switch port := value.(type) {
+	case int64:
+		return strconv.FormatInt(port, 10), true
+	case float64:
+		return strconv.FormatInt(int64(port), 10), true
+	}
+	return "", false
 }
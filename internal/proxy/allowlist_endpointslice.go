@@ -0,0 +1,77 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/set"
+)
+
+// endpointSliceServiceLabel is the label linking an EndpointSlice to its Service
+const endpointSliceServiceLabel = "kubernetes.io/service-name"
+
+var endpointSlicesGVR = schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+
+// endpointSliceHosts returns the addresses and pod names of the ready endpoints of an EndpointSlice,
+// mapped to the ports allowed on them. With the container-ports source, the EndpointSlice ports are allowed.
+func (av *AllowlistValidator) endpointSliceHosts(slice *unstructured.Unstructured, poolName string) map[string]set.Set[string] {
+	var ports set.Set[string]
+	switch av.portPolicy.Source {
+	case PortSourceAny:
+	case PortSourceContainerPorts:
+		ports = set.New(av.portPolicy.Ports...)
+		slicePorts, _, _ := unstructured.NestedSlice(slice.Object, "ports")
+		for _, p := range slicePorts {
+			slicePort, _ := p.(map[string]any)
+			if port, ok := portString(slicePort["port"]); ok {
+				ports.Insert(port)
+			}
+		}
+	default:
+		ports = set.New(av.portPolicy.Ports...).Union(av.poolTargetPorts[poolName])
+	}
+
+	hosts := make(map[string]set.Set[string])
+	endpoints, _, _ := unstructured.NestedSlice(slice.Object, "endpoints")
+	for _, e := range endpoints {
+		endpoint, _ := e.(map[string]any)
+		if !endpointReady(endpoint) {
+			continue
+		}
+		addresses, _, _ := unstructured.NestedStringSlice(endpoint, "addresses")
+		for _, address := range addresses {
+			hosts[address] = ports
+		}
+		if kind, _, _ := unstructured.NestedString(endpoint, "targetRef", "kind"); kind == "Pod" {
+			if podName, _, _ := unstructured.NestedString(endpoint, "targetRef", "name"); podName != "" {
+				hosts[podName] = ports
+			}
+		}
+	}
+	return hosts
+}
+
+// endpointReady returns true unless the endpoint ready condition is false. An unknown
+// condition is interpreted as ready, as recommended by the EndpointSlice API.
+func endpointReady(endpoint map[string]any) bool {
+	ready, found, err := unstructured.NestedBool(endpoint, "conditions", "ready")
+	if err != nil {
+		return false
+	}
+	return !found || ready
+}
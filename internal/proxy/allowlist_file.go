@@ -0,0 +1,255 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// allowlistFileReloadInterval is how often the allowlist file is reloaded and its hostnames resolved again
+	allowlistFileReloadInterval = 10 * time.Second
+
+	// allowlistResolveTimeout bounds the DNS resolution of hostnames
+	allowlistResolveTimeout = 2 * time.Second
+
+	// allowlistResolveCacheTTL is how long the resolved addresses of the prefill targets are cached
+	allowlistResolveCacheTTL = 10 * time.Second
+
+	// allowlistResolveCacheSize bounds the number of prefill targets whose addresses are cached
+	allowlistResolveCacheSize = 1024
+)
+
+// resolvedHost is the cached addresses of a hostname
+type resolvedHost struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// allowlistEntry allows the addresses of a prefix, on a single port or on any port when port is empty
+type allowlistEntry struct {
+	prefix netip.Prefix
+	port   string
+}
+
+// fileAllowlist is an allowlist of hostnames, IPs and CIDRs, optionally with a port, loaded from a file.
+//
+// The file lists one entry per line, e.g. "prefill-1.example.com", "10.0.0.5:8000" or "10.0.0.0/24".
+// Empty lines and lines starting with # are ignored. Hostnames are resolved when the file is loaded,
+// and targets are matched against the resulting addresses after resolving them, so that a hostname
+// cannot be used to reach a disallowed IP.
+type fileAllowlist struct {
+	logger      logr.Logger
+	path        string
+	lookupNetIP func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+	mu      sync.RWMutex
+	content []byte // the last loaded file content
+	entries []allowlistEntry
+
+	resolvedMu sync.Mutex
+	resolved   map[string]resolvedHost // prefill target hostname -> addresses
+}
+
+func newFileAllowlist(path string) *fileAllowlist {
+	return &fileAllowlist{
+		logger:      logr.Discard(),
+		path:        path,
+		lookupNetIP: net.DefaultResolver.LookupNetIP,
+		resolved:    make(map[string]resolvedHost),
+	}
+}
+
+// load reads the allowlist file and resolves its hostnames
+func (f *fileAllowlist) load() error {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	var entries []allowlistEntry
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lineEntries, err := f.parseEntry(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", f.path, line, err)
+		}
+		entries = append(entries, lineEntries...)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	changed := !bytes.Equal(content, f.content)
+	f.content = content
+	f.entries = entries
+	f.mu.Unlock()
+
+	if changed {
+		f.logger.Info("loaded allowlist file", "path", f.path, "entryCount", len(entries))
+	}
+	return nil
+}
+
+// parseEntry parses an allowlist line: a hostname, IP or CIDR, optionally followed by a port
+func (f *fileAllowlist) parseEntry(text string) ([]allowlistEntry, error) {
+	host, port := text, ""
+	if h, p, err := net.SplitHostPort(text); err == nil {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid port in %q", text)
+		}
+		host, port = h, p
+	}
+
+	if prefix, err := netip.ParsePrefix(host); err == nil {
+		return []allowlistEntry{{prefix: prefix.Masked(), port: port}}, nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []allowlistEntry{{prefix: netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), port: port}}, nil
+	}
+
+	addrs, err := f.resolve(context.Background(), host)
+	if err != nil {
+		// keep loading the other entries, the hostname is resolved again on the next reload
+		f.logger.Error(err, "failed to resolve allowlist hostname", "host", host)
+		return nil, nil
+	}
+	entries := make([]allowlistEntry, 0, len(addrs))
+	for _, addr := range addrs {
+		entries = append(entries, allowlistEntry{prefix: netip.PrefixFrom(addr, addr.BitLen()), port: port})
+	}
+	return entries, nil
+}
+
+// resolve returns the addresses of a host, which is either an IP or a hostname
+func (f *fileAllowlist) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, allowlistResolveTimeout)
+	defer cancel()
+	addrs, err := f.lookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, nil
+}
+
+// resolveCached returns the addresses of a prefill target, which are cached for allowlistResolveCacheTTL.
+// Failed resolutions are not cached.
+func (f *fileAllowlist) resolveCached(ctx context.Context, host string) ([]netip.Addr, error) {
+	now := time.Now()
+	f.resolvedMu.Lock()
+	cached, ok := f.resolved[host]
+	f.resolvedMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := f.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	f.resolvedMu.Lock()
+	defer f.resolvedMu.Unlock()
+	if len(f.resolved) >= allowlistResolveCacheSize {
+		for h, r := range f.resolved {
+			if !now.Before(r.expires) {
+				delete(f.resolved, h)
+			}
+		}
+	}
+	if len(f.resolved) < allowlistResolveCacheSize {
+		f.resolved[host] = resolvedHost{addrs: addrs, expires: now.Add(allowlistResolveCacheTTL)}
+	}
+	return addrs, nil
+}
+
+// isAllowed returns true when all the addresses of the host are allowed on the given port. The host
+// is resolved with ctx, usually the request context.
+func (f *fileAllowlist) isAllowed(ctx context.Context, host, port string) bool {
+	addrs, err := f.resolveCached(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		klog.FromContext(ctx).V(4).Info("failed to resolve prefill target", "host", host, "error", err)
+		return false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, addr := range addrs {
+		if !f.matches(addr, port) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows returns true when the address is allowed on the given port
+func (f *fileAllowlist) allows(addr netip.Addr, port string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.matches(addr, port)
+}
+
+func (f *fileAllowlist) matches(addr netip.Addr, port string) bool {
+	for _, entry := range f.entries {
+		if entry.prefix.Contains(addr) && (entry.port == "" || entry.port == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the allowlist file every interval until stopCh is closed.
+// The current entries are kept when the file cannot be loaded.
+func (f *fileAllowlist) watch(stopCh <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if err := f.load(); err != nil {
+			f.logger.Error(err, "failed to reload allowlist file, keeping the current allowlist", "path", f.path)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+	"k8s.io/utils/set"
+)
+
+// fakeHosts resolves hostnames from a static table
+type fakeHosts map[string][]string
+
+func (h fakeHosts) lookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	ips, ok := h[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, netip.MustParseAddr(ip))
+	}
+	return addrs, nil
+}
+
+var _ = Describe("Allowlist file", func() {
+	var (
+		path  string
+		hosts fakeHosts
+		file  *fileAllowlist
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "allowlist")
+		hosts = fakeHosts{
+			"prefill-1.example.com": {"192.168.1.10"},
+			"prefill-2.example.com": {"192.168.1.20", "fd00::20"},
+			"rebind.example.com":    {"192.168.1.10", "169.254.169.254"},
+			"internal.example.com":  {"10.0.0.7"},
+		}
+		file = newFileAllowlist(path)
+		file.lookupNetIP = hosts.lookupNetIP
+	})
+
+	writeAllowlist := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	It("should allow hostnames, IPs, CIDRs and host:port entries", func() {
+		writeAllowlist(`
+# prefillers
+prefill-1.example.com
+prefill-2.example.com:8000
+10.0.0.0/24
+172.16.0.5:8200
+[fd00::1]:8000
+`)
+		Expect(file.load()).To(Succeed())
+
+		Expect(file.isAllowed(context.Background(), "prefill-1.example.com", "9999")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "192.168.1.10", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "prefill-2.example.com", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "prefill-2.example.com", "8001")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "fd00::20", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "10.0.0.99", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "internal.example.com", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "10.0.1.1", "8000")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "172.16.0.5", "8200")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "172.16.0.5", "8000")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "172.16.0.5", "")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "fd00::1", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "::ffff:10.0.0.1", "8000")).To(BeTrue())
+	})
+
+	It("should match targets after resolving them", func() {
+		writeAllowlist("prefill-1.example.com\n")
+		Expect(file.load()).To(Succeed())
+
+		// resolves to an allowed and a disallowed address
+		Expect(file.isAllowed(context.Background(), "rebind.example.com", "8000")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "unknown.example.com", "8000")).To(BeFalse())
+	})
+
+	It("should cache the resolved prefill targets", func() {
+		writeAllowlist("prefill-1.example.com\n")
+		Expect(file.load()).To(Succeed())
+
+		var lookups int
+		file.lookupNetIP = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			lookups++
+			return hosts.lookupNetIP(ctx, network, host)
+		}
+		Expect(file.isAllowed(context.Background(), "prefill-1.example.com", "8000")).To(BeTrue())
+		Expect(file.isAllowed(context.Background(), "prefill-1.example.com", "8000")).To(BeTrue())
+		Expect(lookups).To(Equal(1))
+
+		// failures are not cached
+		Expect(file.isAllowed(context.Background(), "unknown.example.com", "8000")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "unknown.example.com", "8000")).To(BeFalse())
+		Expect(lookups).To(Equal(3))
+	})
+
+	It("should resolve the prefill targets with the request context", func() {
+		writeAllowlist("prefill-1.example.com\n")
+		Expect(file.load()).To(Succeed())
+
+		file.lookupNetIP = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return hosts.lookupNetIP(ctx, network, host)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(file.isAllowed(ctx, "prefill-1.example.com", "8000")).To(BeFalse())
+		Expect(file.isAllowed(context.Background(), "prefill-1.example.com", "8000")).To(BeTrue())
+	})
+
+	It("should skip hostnames that cannot be resolved", func() {
+		writeAllowlist("unknown.example.com\n10.0.0.1\n")
+		Expect(file.load()).To(Succeed())
+		Expect(file.isAllowed(context.Background(), "10.0.0.1", "8000")).To(BeTrue())
+	})
+
+	It("should reject invalid entries", func() {
+		writeAllowlist("10.0.0.1:http\n")
+		Expect(file.load()).To(MatchError(ContainSubstring(":1: invalid port")))
+
+		writeAllowlist("10.0.0.1\n10.0.0.2:70000\n")
+		Expect(file.load()).To(MatchError(ContainSubstring(":2: invalid port")))
+	})
+
+	It("should reload the file on change and keep the current allowlist when invalid", func() {
+		writeAllowlist("10.0.0.1\n")
+		Expect(file.load()).To(Succeed())
+
+		stopCh := make(chan struct{})
+		DeferCleanup(func() { close(stopCh) })
+		go file.watch(stopCh, 10*time.Millisecond)
+
+		writeAllowlist("10.0.0.2\n")
+		Eventually(func() bool { return file.isAllowed(context.Background(), "10.0.0.2", "8000") }).Should(BeTrue())
+		Expect(file.isAllowed(context.Background(), "10.0.0.1", "8000")).To(BeFalse())
+
+		writeAllowlist("10.0.0.3:invalid\n")
+		Consistently(func() bool { return file.isAllowed(context.Background(), "10.0.0.2", "8000") }, 100*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should be combined with the InferencePool allowlist", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		writeAllowlist("10.0.0.0/24:8000\n")
+
+		validator, err := NewAllowlistValidator(Config{EnableSSRFProtection: true, AllowlistFile: path})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validator.Start(ctx)).To(Succeed())
+		DeferCleanup(validator.Stop)
+
+		validator.allowedTargetsMu.Lock()
+		validator.allowedTargets["10.244.1.100"] = set.New("8000")
+		validator.allowedTargetsMu.Unlock()
+
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.5:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.5:9000")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.244.1.101:8000")).To(BeFalse())
+	})
+
+	It("should check the dialed addresses", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		writeAllowlist("10.0.0.0/24:8000\n")
+
+		validator, err := NewAllowlistValidator(Config{EnableSSRFProtection: true, AllowlistFile: path})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validator.Start(ctx)).To(Succeed())
+		DeferCleanup(validator.Stop)
+
+		validator.allowedTargetsMu.Lock()
+		validator.allowedTargets["10.244.1.100"] = set.New("8000")
+		validator.allowedTargetsMu.Unlock()
+
+		control := validator.dialControl()
+		Expect(control).ToNot(BeNil())
+		Expect(control(ctx, "tcp", "10.0.0.5:8000", nil)).To(Succeed())
+		Expect(control(ctx, "tcp", "10.244.1.100:8000", nil)).To(Succeed())
+		Expect(control(ctx, "tcp", "10.0.0.5:9000", nil)).To(MatchError(errTargetNotAllowed))
+		Expect(control(ctx, "tcp", "169.254.169.254:80", nil)).To(MatchError(errTargetNotAllowed))
+
+		disabled, err := NewAllowlistValidator(Config{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(disabled.dialControl()).To(BeNil())
+	})
+
+	DescribeTable("should reject prefillers resolving to addresses not in the allowlist when dialed",
+		func(checkedAddrs []string, expectedStatus int) {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+			DeferCleanup(decodeBackend.Close)
+			prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+			prefillBackend := httptest.NewServer(prefillHandler)
+			DeferCleanup(prefillBackend.Close)
+			_, prefillPort, err := net.SplitHostPort(prefillBackend.Listener.Addr().String())
+			Expect(err).ToNot(HaveOccurred())
+
+			// localhost resolves to the checked addresses when checking the target, then to the loopback
+			// addresses when dialed, like a DNS rebinding attack
+			writeAllowlist("localhost\n")
+			decodeURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{EnableSSRFProtection: true, AllowlistFile: path})
+			Expect(err).ToNot(HaveOccurred())
+			proxy.allowlistValidator.file.lookupNetIP = fakeHosts{"localhost": checkedAddrs}.lookupNetIP
+
+			go func() {
+				defer GinkgoRecover()
+
+				err := proxy.Start(ctx)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+			waitForProxy(proxy)
+
+			body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, net.JoinHostPort("localhost", prefillPort))
+
+			rp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rp.Body.Close()).To(Succeed())
+			Expect(rp.StatusCode).To(Equal(expectedStatus))
+			if expectedStatus == http.StatusForbidden {
+				Expect(rp.Header.Get(responseHeaderErrorCode)).To(Equal(errorCodeRequestSSRFRejected))
+				Expect(prefillHandler.RequestCount.Load()).To(BeZero())
+			}
+		},
+		Entry("same addresses", []string{"127.0.0.1", "::1"}, http.StatusOK),
+		Entry("rebound addresses", []string{"10.0.0.1"}, http.StatusForbidden),
+	)
+
+	It("should fail to start when the allowlist file is missing", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		validator, err := NewAllowlistValidator(Config{EnableSSRFProtection: true, AllowlistFile: path})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validator.Start(ctx)).To(MatchError(ContainSubstring("failed to load allowlist file")))
+	})
+})
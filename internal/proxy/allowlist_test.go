@@ -17,8 +17,21 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2" // nolint:revive
 	. "github.com/onsi/gomega"    // nolint:revive
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2/ktesting"
 	"k8s.io/utils/set"
 )
 
@@ -28,14 +41,14 @@ var _ = Describe("AllowlistValidator", func() {
 
 		BeforeEach(func() {
 			var err error
-			validator, err = NewAllowlistValidator(false, "test-namespace", "test-pool")
+			validator, err = NewAllowlistValidator(Config{InferencePoolNamespace: "test-namespace", InferencePoolName: "test-pool"})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("should allow all targets", func() {
-			Expect(validator.IsAllowed("malicious.example.com:8080")).To(BeTrue())
-			Expect(validator.IsAllowed("10.0.0.1:8000")).To(BeTrue())
-			Expect(validator.IsAllowed("http://evil.host/ssrf")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "malicious.example.com:8080")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "http://evil.host/ssrf")).To(BeTrue())
 		})
 	})
 
@@ -46,47 +59,405 @@ var _ = Describe("AllowlistValidator", func() {
 			validator = &AllowlistValidator{
 				enabled:   true,
 				namespace: "test-namespace",
-				allowedTargets: set.New(
-					"10.244.1.100",
-					"valid-pod",
-					"valid-pod.test-namespace.svc.cluster.local",
-				),
+				allowedTargets: map[string]set.Set[string]{
+					"10.244.1.100": set.New("8000"),
+					"valid-pod":    set.New("8000", "8200"),
+					"valid-pod.test-namespace.svc.cluster.local": set.New("8000"),
+					"10.244.1.200": nil, // any port
+				},
 			}
 		})
 
 		It("should allow targets in the allowlist", func() {
-			Expect(validator.IsAllowed("10.244.1.100:8000")).To(BeTrue())
-			Expect(validator.IsAllowed("valid-pod:8000")).To(BeTrue())
-			Expect(validator.IsAllowed("valid-pod.test-namespace.svc.cluster.local:8000")).To(BeTrue())
-			Expect(validator.IsAllowed("10.244.1.100:8001")).To(BeTrue()) // Different port, same host
-			Expect(validator.IsAllowed("valid-pod:9999")).To(BeTrue())    // Any port on allowed host
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "valid-pod:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "valid-pod:8200")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "valid-pod.test-namespace.svc.cluster.local:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.200:9999")).To(BeTrue()) // Any port on host allowing any port
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.200")).To(BeTrue())
 		})
 
 		It("should block targets not in the allowlist", func() {
-			Expect(validator.IsAllowed("malicious.example.com:8080")).To(BeFalse())
-			Expect(validator.IsAllowed("10.0.0.1:8000")).To(BeFalse())
-			Expect(validator.IsAllowed("evil-pod:8000")).To(BeFalse())
+			Expect(validator.IsAllowed(context.Background(), "malicious.example.com:8080")).To(BeFalse())
+			Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeFalse())
+			Expect(validator.IsAllowed(context.Background(), "evil-pod:8000")).To(BeFalse())
+		})
+
+		It("should block ports not allowed on allowed hosts", func() {
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8001")).To(BeFalse()) // Different port, same host
+			Expect(validator.IsAllowed(context.Background(), "valid-pod:9999")).To(BeFalse())
+			Expect(validator.IsAllowed(context.Background(), "valid-pod")).To(BeFalse()) // No port
 		})
 
 		It("should parse host:port correctly", func() {
 			// Test host:port format parsing
-			normalized := validator.normalizeHostPort("10.244.1.100:8000")
-			Expect(normalized).To(Equal("10.244.1.100"))
+			host, port := validator.normalizeHostPort("10.244.1.100:8000")
+			Expect(host).To(Equal("10.244.1.100"))
+			Expect(port).To(Equal("8000"))
 
-			normalized = validator.normalizeHostPort("valid-pod:8000")
-			Expect(normalized).To(Equal("valid-pod"))
+			host, port = validator.normalizeHostPort("valid-pod:8000")
+			Expect(host).To(Equal("valid-pod"))
+			Expect(port).To(Equal("8000"))
 
 			// Just hostname (no port)
-			normalized = validator.normalizeHostPort("valid-pod")
-			Expect(normalized).To(Equal("valid-pod"))
+			host, port = validator.normalizeHostPort("valid-pod")
+			Expect(host).To(Equal("valid-pod"))
+			Expect(port).To(BeEmpty())
 
 			// IPv6 addresses (net.SplitHostPort handles these correctly)
-			normalized = validator.normalizeHostPort("[::1]:8000")
-			Expect(normalized).To(Equal("::1"))
+			host, port = validator.normalizeHostPort("[::1]:8000")
+			Expect(host).To(Equal("::1"))
+			Expect(port).To(Equal("8000"))
 
 			// IPv6 without port
-			normalized = validator.normalizeHostPort("::1")
-			Expect(normalized).To(Equal("::1"))
+			host, _ = validator.normalizeHostPort("::1")
+			Expect(host).To(Equal("::1"))
+		})
+	})
+
+	Context("when computing the allowed ports of a pod", func() {
+		pod := &unstructured.Unstructured{Object: map[string]any{
+			"metadata": map[string]any{"name": "prefill-pod"},
+			"spec": map[string]any{
+				"containers": []any{
+					map[string]any{"ports": []any{
+						map[string]any{"containerPort": int64(8000)},
+						map[string]any{"containerPort": int64(5557)},
+					}},
+				},
+			},
+			"status": map[string]any{
+				"podIP":      "10.244.1.100",
+				"conditions": []any{map[string]any{"type": "Ready", "status": "True"}},
+			},
+		}}
+
+		newValidator := func(portPolicy PortPolicy) *AllowlistValidator {
+			return &AllowlistValidator{
+				enabled:         true,
+				portPolicy:      portPolicy,
+				allowedTargets:  map[string]set.Set[string]{},
+				poolTargetPorts: map[string]set.Set[string]{"pool": set.New("8000")},
+			}
+		}
+
+		It("should allow the InferencePool target port", func() {
+			validator := newValidator(PortPolicy{Source: PortSourceTargetPort, Ports: []string{"8100"}})
+			validator.setEndpoint("pool/prefill-pod", validator.podHosts(pod, "pool"))
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "prefill-pod:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8100")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:5557")).To(BeFalse())
+		})
+
+		It("should allow the container ports", func() {
+			validator := newValidator(PortPolicy{Source: PortSourceContainerPorts})
+			validator.setEndpoint("pool/prefill-pod", validator.podHosts(pod, "pool"))
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:8000")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:5557")).To(BeTrue())
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:9090")).To(BeFalse())
+		})
+
+		It("should allow any port", func() {
+			validator := newValidator(PortPolicy{Source: PortSourceAny})
+			validator.setEndpoint("pool/prefill-pod", validator.podHosts(pod, "pool"))
+			Expect(validator.IsAllowed(context.Background(), "10.244.1.100:9090")).To(BeTrue())
+		})
+
+		It("should validate the port policy", func() {
+			Expect(PortPolicy{}.Validate()).To(Succeed())
+			Expect(PortPolicy{Source: "unknown"}.Validate()).ToNot(Succeed())
+			Expect(PortPolicy{Ports: []string{"http"}}.Validate()).ToNot(Succeed())
+			Expect(PortPolicy{Ports: []string{"70000"}}.Validate()).ToNot(Succeed())
 		})
 	})
 })
+
+var _ = Describe("AllowlistValidator with InferencePool", func() {
+	newPod := func(name, ip string, podLabels map[string]any, ready bool) *unstructured.Unstructured {
+		readyStatus := "False"
+		if ready {
+			readyStatus = "True"
+		}
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]any{"name": name, "namespace": "test-namespace", "labels": podLabels},
+			"status": map[string]any{
+				"podIP":      ip,
+				"conditions": []any{map[string]any{"type": "Ready", "status": readyStatus}},
+			},
+		}}
+	}
+
+	newEndpointSlice := func(name string, endpoints ...any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "discovery.k8s.io/v1",
+			"kind":       "EndpointSlice",
+			"metadata": map[string]any{
+				"name":      name,
+				"namespace": "test-namespace",
+				"labels":    map[string]any{endpointSliceServiceLabel: "vllm"},
+			},
+			"addressType": "IPv4",
+			"ports":       []any{map[string]any{"name": "http", "port": int64(8000)}},
+			"endpoints":   endpoints,
+		}}
+	}
+
+	newEndpoint := func(ip, podName string, ready any) map[string]any {
+		endpoint := map[string]any{
+			"addresses": []any{ip},
+			"targetRef": map[string]any{"kind": "Pod", "name": podName, "namespace": "test-namespace"},
+		}
+		if ready != nil {
+			endpoint["conditions"] = map[string]any{"ready": ready}
+		}
+		return endpoint
+	}
+
+	startValidator := func(poolGVR schema.GroupVersionResource, pool *unstructured.Unstructured, endpointSliceService string,
+		objects ...runtime.Object) (*AllowlistValidator, *dynamicfake.FakeDynamicClient) {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+
+		pool.SetAPIVersion(poolGVR.GroupVersion().String())
+		pool.SetKind("InferencePool")
+		pool.SetName("test-pool")
+		pool.SetNamespace("test-namespace")
+
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{
+				poolGVR:           "InferencePoolList",
+				podsGVR:           "PodList",
+				endpointSlicesGVR: "EndpointSliceList",
+			},
+			append([]runtime.Object{pool}, objects...)...,
+		)
+		discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{
+			Resources: []*metav1.APIResourceList{{
+				GroupVersion: poolGVR.GroupVersion().String(),
+				APIResources: []metav1.APIResource{{Name: inferencePoolResource, Namespaced: true, Kind: "InferencePool"}},
+			}},
+		}}
+
+		validator := &AllowlistValidator{
+			enabled:              true,
+			dynamicClient:        dynamicClient,
+			discoveryClient:      discoveryClient,
+			namespace:            "test-namespace",
+			poolName:             "test-pool",
+			endpointSliceService: endpointSliceService,
+			portPolicy:           PortPolicy{Source: PortSourceTargetPort},
+			syncTimeout:          10 * time.Second,
+			allowedTargets:       make(map[string]set.Set[string]),
+			poolTargetPorts:      make(map[string]set.Set[string]),
+			poolSelectors:        make(map[string]string),
+			poolGenerations:      make(map[string]int),
+			informers:            make(map[string]cache.SharedInformer),
+			informerSynced:       make(map[string]cache.InformerSynced),
+			informerStopChans:    make(map[string]chan struct{}),
+			stopCh:               make(chan struct{}),
+		}
+		Expect(validator.Start(ctx)).To(Succeed())
+		DeferCleanup(validator.Stop)
+		Expect(validator.poolGVR).To(Equal(poolGVR))
+		return validator, dynamicClient
+	}
+
+	pods := func() []runtime.Object {
+		return []runtime.Object{
+			newPod("prefill-pod", "10.0.0.1", map[string]any{"app": "vllm", "role": "prefill"}, true),
+			newPod("decode-pod", "10.0.0.2", map[string]any{"app": "vllm", "role": "decode"}, true),
+			newPod("other-pod", "10.0.0.3", map[string]any{"app": "other"}, true),
+			newPod("starting-pod", "10.0.0.4", map[string]any{"app": "vllm", "role": "prefill"}, false),
+		}
+	}
+
+	It("should watch v1 InferencePools with a LabelSelector", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector": map[string]any{
+					"matchLabels": map[string]any{"app": "vllm"},
+					"matchExpressions": []any{
+						map[string]any{"key": "role", "operator": "In", "values": []any{"prefill", "both"}},
+					},
+				},
+				"targetPorts": []any{map[string]any{"number": int64(8000)}},
+			},
+		}}
+		validator, _ := startValidator(inferencePoolGVRs[0], pool, "", pods()...)
+
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8000") }).Should(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "prefill-pod:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8001")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.3:8000")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.4:8000")).To(BeFalse()) // not ready
+	})
+
+	It("should watch v1alpha2 InferencePools with a map of labels", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector":         map[string]any{"app": "vllm"},
+				"targetPortNumber": int64(8000),
+			},
+		}}
+		validator, _ := startValidator(inferencePoolGVRs[1], pool, "", pods()...)
+
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8000") }).Should(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.3:8000")).To(BeFalse())
+	})
+
+	It("should update the allowlist incrementally when pods change", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector":         map[string]any{"app": "vllm"},
+				"targetPortNumber": int64(8000),
+			},
+		}}
+		validator, dynamicClient := startValidator(inferencePoolGVRs[1], pool, "", pods()...)
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8000") }).Should(BeTrue())
+
+		podsClient := dynamicClient.Resource(podsGVR).Namespace("test-namespace")
+		_, err := podsClient.Update(context.Background(), newPod("starting-pod", "10.0.0.4", map[string]any{"app": "vllm"}, true), metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.4:8000") }).Should(BeTrue())
+
+		_, err = podsClient.Update(context.Background(), newPod("prefill-pod", "10.0.0.1", map[string]any{"app": "vllm"}, false), metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8000") }).Should(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "prefill-pod:8000")).To(BeFalse())
+
+		Expect(podsClient.Delete(context.Background(), "decode-pod", metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.2:8000") }).Should(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.4:8000")).To(BeTrue())
+	})
+
+	It("should keep the endpoint informer when the InferencePool is resynced", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector":         map[string]any{"app": "vllm"},
+				"targetPortNumber": int64(8000),
+			},
+		}}
+		validator, dynamicClient := startValidator(inferencePoolGVRs[1], pool, "", pods()...)
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+		validator.informersMu.RLock()
+		informer := validator.informers["test-pool"]
+		validator.informersMu.RUnlock()
+
+		poolsClient := dynamicClient.Resource(inferencePoolGVRs[1]).Namespace("test-namespace")
+		pool.SetLabels(map[string]string{"updated": "true"})
+		_, err := poolsClient.Update(context.Background(), pool, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Consistently(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8000") }).Should(BeTrue())
+		validator.informersMu.RLock()
+		defer validator.informersMu.RUnlock()
+		Expect(validator.informers["test-pool"]).To(BeIdenticalTo(informer))
+	})
+
+	It("should replace the endpoints when the InferencePool selector changes", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector":         map[string]any{"app": "vllm"},
+				"targetPortNumber": int64(8000),
+			},
+		}}
+		validator, dynamicClient := startValidator(inferencePoolGVRs[1], pool, "", pods()...)
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeTrue())
+
+		poolsClient := dynamicClient.Resource(inferencePoolGVRs[1]).Namespace("test-namespace")
+		Expect(unstructured.SetNestedField(pool.Object, map[string]any{"role": "prefill"}, "spec", "selector")).To(Succeed())
+		Expect(unstructured.SetNestedField(pool.Object, int64(8100), "spec", "targetPortNumber")).To(Succeed())
+		_, err := poolsClient.Update(context.Background(), pool, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.1:8100") }).Should(BeTrue())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.2:8000") }).Should(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeFalse())
+	})
+
+	It("should allow the ready endpoints of the EndpointSlices", func() {
+		pool := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"selector":    map[string]any{"matchLabels": map[string]any{"app": "vllm"}},
+				"targetPorts": []any{map[string]any{"number": int64(8000)}},
+			},
+		}}
+		validator, dynamicClient := startValidator(inferencePoolGVRs[0], pool, "vllm",
+			newEndpointSlice("vllm-abc",
+				newEndpoint("10.0.0.1", "prefill-pod", true),
+				newEndpoint("10.0.0.2", "decode-pod", nil),
+				newEndpoint("10.0.0.4", "starting-pod", false)),
+		)
+
+		// Start waited for the EndpointSlices to sync
+		Expect(validator.Synced()).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "prefill-pod:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8001")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.4:8000")).To(BeFalse())
+
+		slicesClient := dynamicClient.Resource(endpointSlicesGVR).Namespace("test-namespace")
+		_, err := slicesClient.Update(context.Background(), newEndpointSlice("vllm-abc",
+			newEndpoint("10.0.0.2", "decode-pod", true),
+			newEndpoint("10.0.0.4", "starting-pod", true)), metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.4:8000") }).Should(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "prefill-pod:8000")).To(BeFalse())
+
+		Expect(slicesClient.Delete(context.Background(), "vllm-abc", metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool { return validator.IsAllowed(context.Background(), "10.0.0.2:8000") }).Should(BeFalse())
+		Expect(validator.allowedTargets).To(BeEmpty())
+		Expect(validator.hostEndpoints).To(BeEmpty())
+	})
+
+	It("should keep a host allowed while another endpoint allows it", func() {
+		validator := &AllowlistValidator{enabled: true}
+		validator.setEndpoint("pool/slice-a", map[string]set.Set[string]{"10.0.0.1": set.New("8000")})
+		validator.setEndpoint("pool/slice-b", map[string]set.Set[string]{"10.0.0.1": set.New("8200")})
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8200")).To(BeTrue())
+
+		validator.setEndpoint("pool/slice-a", nil)
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeFalse())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8200")).To(BeTrue())
+
+		validator.setEndpoint("pool/slice-b", map[string]set.Set[string]{"10.0.0.1": nil})
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:9999")).To(BeTrue())
+	})
+
+	It("should fail when no supported InferencePool version is served", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		validator := &AllowlistValidator{
+			enabled:         true,
+			discoveryClient: &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}},
+			poolName:        "test-pool",
+			stopCh:          make(chan struct{}),
+		}
+		Expect(validator.Start(ctx)).To(MatchError(ContainSubstring("no supported InferencePool API version")))
+	})
+
+	It("should parse the InferencePool selectors", func() {
+		selector, err := poolSelector(map[string]any{"selector": map[string]any{
+			"matchExpressions": []any{map[string]any{"key": "role", "operator": "NotIn", "values": []any{"decode"}}},
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(selector.Matches(labels.Set{"role": "prefill"})).To(BeTrue())
+		Expect(selector.Matches(labels.Set{"role": "decode"})).To(BeFalse())
+
+		_, err = poolSelector(map[string]any{"selector": map[string]any{
+			"matchExpressions": []any{map[string]any{"key": "role", "operator": "Unknown"}},
+		}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = poolSelector(map[string]any{"selector": map[string]any{}})
+		Expect(err).To(HaveOccurred())
+
+		_, err = poolSelector(map[string]any{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,146 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are not returned to the pool, so that
+// a few very large prompts do not pin their memory
+const maxPooledBufferSize = 4 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns the buffer to the pool. It must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// requestBody is a pooled request body, shared by the requests sent to the prefillers and to the decoder.
+// The transports may read and close a request body after the response is received, so the buffer is only
+// returned to the pool once released by its owner and closed by all its readers.
+type requestBody struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+func newRequestBody() *requestBody {
+	b := &requestBody{buf: getBuffer()}
+	b.refs.Store(1)
+	return b
+}
+
+// readRequestBody reads the request body into a pooled buffer. It returns an *http.MaxBytesError when the
+// body is larger than the limit set by http.MaxBytesReader.
+func readRequestBody(r *http.Request) (*requestBody, error) {
+	b := newRequestBody()
+	if r.ContentLength > 0 {
+		b.buf.Grow(int(r.ContentLength))
+	}
+	if _, err := b.buf.ReadFrom(r.Body); err != nil {
+		b.release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Bytes returns the body, valid until the body is released
+func (b *requestBody) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Len returns the body length
+func (b *requestBody) Len() int64 {
+	return int64(b.buf.Len())
+}
+
+// retain adds a reference to the body, to be released by the caller
+func (b *requestBody) retain() *requestBody {
+	b.refs.Add(1)
+	return b
+}
+
+// release drops a reference to the body, returning its buffer to the pool with the last one
+func (b *requestBody) release() {
+	if b.refs.Add(-1) == 0 {
+		putBuffer(b.buf)
+	}
+}
+
+// reader returns a reader of the body, to be set as the body of an outgoing request, which closes it
+func (b *requestBody) reader() io.ReadCloser {
+	return &requestBodyReader{Reader: bytes.NewReader(b.retain().Bytes()), body: b}
+}
+
+// requestBodyReader releases its reference to the body when closed
+type requestBodyReader struct {
+	*bytes.Reader
+	body   *requestBody
+	closed atomic.Bool
+}
+
+func (r *requestBodyReader) Close() error {
+	if !r.closed.Swap(true) {
+		r.body.release()
+	}
+	return nil
+}
+
+// limitRequestBody limits the request body to the maximum size, zero meaning no limit. Reading a larger body
+// fails with an *http.MaxBytesError. It returns false when the request declares a larger content length.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	if r.ContentLength > limit {
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// errBodyTooLarge returns the error reported for a request body larger than the maximum size
+func errBodyTooLarge(limit int64) error {
+	return fmt.Errorf("request body too large: the maximum size is %d bytes", limit)
+}
+
+// bodyTooLarge returns the maximum size of the request body when the error reports a larger body
+func bodyTooLarge(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr.Limit, true
+	}
+	return 0, false
+}
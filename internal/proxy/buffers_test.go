@@ -0,0 +1,237 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// chunkedReader hides the length of the request body, which is then sent chunked
+type chunkedReader struct {
+	io.Reader
+}
+
+var _ = Describe("Request body size", func() {
+	var (
+		ctx             context.Context
+		decodeHandler   *mock.ChatCompletionHandler
+		prefillHandler  *mock.ChatCompletionHandler
+		prefillHostPort string
+		proxyBaseAddr   string
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		prefillHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		proxy, err := NewProxy("0", decodeURL, Config{MaxRequestBodySize: 1024}) // port 0 to automatically choose one that's available.
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		proxyBaseAddr = "http://" + proxy.addr.String()
+		prefillHostPort = prefillBackend.URL[len("http://"):]
+	})
+
+	DescribeTable("should reject the requests larger than the maximum size",
+		func(disaggregated bool, chunked bool, promptSize int, expectedStatus int) {
+			var body io.Reader = strings.NewReader(`{"model": "Qwen/Qwen2-0.5B", "max_tokens": 50, "prompt": "` + strings.Repeat("a", promptSize) + `"}`)
+			if chunked {
+				body = chunkedReader{body}
+			}
+			req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, body)
+			Expect(err).ToNot(HaveOccurred())
+			if disaggregated {
+				req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+			}
+
+			rp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			response, err := io.ReadAll(rp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rp.Body.Close()).To(Succeed())
+
+			Expect(rp.StatusCode).To(Equal(expectedStatus))
+			if expectedStatus == http.StatusRequestEntityTooLarge {
+				Expect(string(response)).To(ContainSubstring("the maximum size is 1024 bytes"))
+				Expect(prefillHandler.RequestCount.Load()).To(BeZero())
+				Expect(decodeHandler.CompletionRequests).To(BeEmpty())
+			}
+		},
+		Entry("disaggregated", true, false, 2048, http.StatusRequestEntityTooLarge),
+		Entry("disaggregated, chunked", true, true, 2048, http.StatusRequestEntityTooLarge),
+		Entry("passthrough", false, false, 2048, http.StatusRequestEntityTooLarge),
+		Entry("passthrough, chunked", false, true, 2048, http.StatusRequestEntityTooLarge),
+		Entry("disaggregated, within the limit", true, true, 512, http.StatusOK),
+		Entry("passthrough, within the limit", false, false, 512, http.StatusOK),
+	)
+})
+
+var _ = Describe("Request body", func() {
+	It("should only be returned to the pool once released and closed by all its readers", func() {
+		body := newRequestBody()
+		body.buf.WriteString(`{"prompt": "Hello"}`)
+
+		reader := body.reader()
+		body.release()
+		Expect(body.refs.Load()).To(BeNumerically("==", 1))
+
+		content, err := io.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal(`{"prompt": "Hello"}`))
+
+		Expect(reader.Close()).To(Succeed())
+		Expect(reader.Close()).To(Succeed()) // closing twice must not release twice
+		Expect(body.refs.Load()).To(BeZero())
+	})
+})
+
+// benchmarkPromptSizes are the prompt sizes of the benchmarks, from short to long-context prompts
+var benchmarkPromptSizes = []int{1 << 10, 100 << 10, 1 << 20}
+
+// benchmarkRequest returns a completion request whose prompt has the given size
+func benchmarkRequest(promptSize int) []byte {
+	return []byte(`{"model": "Qwen/Qwen2-0.5B", "max_tokens": 50, "stream": true, "stream_options": {"include_usage": true}, "prompt": "` +
+		strings.Repeat("a", promptSize) + `"}`)
+}
+
+// BenchmarkRequestRewriting measures the prefill and decode request rewriting alone
+func BenchmarkRequestRewriting(b *testing.B) {
+	ctx := context.Background()
+	connector, err := NewConnector(ConnectorNIXLV2, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	prefillState, err := connector.InterpretPrefillResponse(ctx,
+		[]byte(`{"kv_transfer_params":{"remote_engine_id":"e","remote_block_ids":[1,2,3],"remote_host":"10.0.0.1","remote_port":5600}}`))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range benchmarkPromptSizes {
+		original := benchmarkRequest(size)
+		b.Run(fmt.Sprintf("prompt=%dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(original)))
+			for range b.N {
+				r := httptest.NewRequest(http.MethodPost, CompletionsPath, bytes.NewReader(original))
+				body, err := readRequestBody(r)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				prefillRequest, err := ParseCompletionRequest(body.Bytes())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := connector.PreparePrefill(ctx, r, prefillRequest); err != nil {
+					b.Fatal(err)
+				}
+				pbody := prefillRequest.requestBody(body)
+
+				decodeRequest, err := ParseCompletionRequest(body.Bytes())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := connector.PrepareDecode(ctx, r, decodeRequest, prefillState); err != nil {
+					b.Fatal(err)
+				}
+				dbody := decodeRequest.requestBody(body)
+
+				pbody.release()
+				dbody.release()
+				body.release()
+			}
+		})
+	}
+}
+
+// BenchmarkDisaggregatedRequest measures a disaggregated request, from the client request to the decoder response
+func BenchmarkDisaggregatedRequest(b *testing.B) {
+	prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)                                                                                                                             //nolint:all
+		w.Write([]byte(`{"id":"cmpl-1","kv_transfer_params":{"remote_engine_id":"e","remote_block_ids":[1,2,3],"remote_host":"10.0.0.1","remote_port":5600}}`)) //nolint:all
+	}))
+	defer prefillBackend.Close()
+	decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)        //nolint:all
+		w.Write([]byte(`{"id":"cmpl-1"}`)) //nolint:all
+	}))
+	defer decodeBackend.Close()
+
+	decodeURL, err := url.Parse(decodeBackend.URL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	proxy, err := NewProxy("0", decodeURL, Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	proxy.logger = logr.Discard()
+	handler := proxy.createRoutes()
+	prefillHostPort := prefillBackend.URL[len("http://"):]
+
+	for _, size := range benchmarkPromptSizes {
+		original := benchmarkRequest(size)
+		b.Run(fmt.Sprintf("prompt=%dKB", size>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(original)))
+			for range b.N {
+				r := httptest.NewRequest(http.MethodPost, CompletionsPath, bytes.NewReader(original))
+				r.Header.Set(requestHeaderPrefillHostPort, prefillHostPort)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status code %d: %s", w.Code, w.Body.String())
+				}
+			}
+		})
+	}
+}
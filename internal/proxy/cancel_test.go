@@ -0,0 +1,142 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// interruptingConnector signals when the prefill response is received, then waits for
+// the client to disconnect before letting the protocol continue
+type interruptingConnector struct {
+	*nixlV2Connector
+	prefilled chan struct{}
+}
+
+func (c *interruptingConnector) InterpretPrefillResponse(ctx context.Context, prefillerResponse []byte) (map[string]any, error) {
+	close(c.prefilled)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+	}
+	return c.nixlV2Connector.InterpretPrefillResponse(ctx, prefillerResponse)
+}
+
+var _ = Describe("Client cancellation", func() {
+	It("should skip the decode and release the prefiller KV cache", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		var (
+			mu           sync.Mutex
+			abortRequest map[string]any
+		)
+		aborted := make(chan struct{})
+		mux := http.NewServeMux()
+		mux.Handle(CompletionsPath, &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		mux.HandleFunc("/v1/kv_transfer/abort", func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body) // nolint:all
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(json.Unmarshal(b, &abortRequest)).To(Succeed())
+			close(aborted)
+		})
+		prefillBackend := httptest.NewServer(mux)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err := NewProxy("0", decodeURL, Config{
+			Connector:        ConnectorNIXLV2,
+			ConnectorOptions: map[string]string{nixlV2OptionAbortPath: "/v1/kv_transfer/abort"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		connector := &interruptingConnector{
+			nixlV2Connector: proxy.connector.(*nixlV2Connector),
+			prefilled:       make(chan struct{}),
+		}
+		proxy.connector = connector
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+
+		clientCtx, clientCancel := context.WithCancel(ctx)
+		go func() {
+			<-connector.prefilled
+			clientCancel()
+		}()
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequestWithContext(clientCtx, http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		_, err = http.DefaultClient.Do(req)
+		Expect(err).To(MatchError(context.Canceled))
+
+		Eventually(aborted).Should(BeClosed())
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(abortRequest).To(HaveKey(requestFieldKVTransferParams))
+		kvTransferParams, ok := abortRequest[requestFieldKVTransferParams].(map[string]any)
+		Expect(ok).To(BeTrue())
+		Expect(kvTransferParams).To(HaveKeyWithValue(requestFieldRemoteBlockIDs, HaveLen(3)))
+		Expect(decodeHandler.RequestCount.Load()).To(BeZero())
+	})
+
+	It("should not release the KV cache when the abort path is disabled", func() {
+		for _, options := range []map[string]string{nil, {nixlV2OptionAbortPath: ""}} {
+			connector, err := NewConnector(ConnectorNIXLV2, options)
+			Expect(err).ToNot(HaveOccurred())
+
+			areq := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+			body, err := connector.(PrefillAborter).PrepareAbort(context.Background(), areq,
+				map[string]any{requestFieldKVTransferParams: map[string]any{}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(BeNil())
+		}
+
+		_, err := NewConnector(ConnectorNIXLV2, map[string]string{nixlV2OptionAbortPath: "abort"})
+		Expect(err).To(HaveOccurred())
+	})
+})
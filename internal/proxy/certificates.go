@@ -0,0 +1,238 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// certificateReloadInterval is how often the certificate and CA files are checked for changes
+	certificateReloadInterval = 10 * time.Second
+
+	// certificateExpiryWarning is the remaining validity below which loading a certificate logs a warning
+	certificateExpiryWarning = 7 * 24 * time.Hour
+
+	certificateServer          = "server"
+	certificatePrefillerClient = "prefiller-client"
+)
+
+// certificateReloader serves a key pair loaded from files, which is replaced when the files change
+type certificateReloader struct {
+	name     string // the certificate name in the metrics and logs
+	certFile string
+	keyFile  string
+
+	cert    atomic.Pointer[tls.Certificate]
+	certPEM []byte // the content of the files of the current key pair
+	keyPEM  []byte
+}
+
+// newCertificateReloader loads the key pair from the given files
+func newCertificateReloader(logger logr.Logger, name, certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{name: name, certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(logger); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the key pair again when the files changed. The new key pair is only used when valid:
+// the key matches the certificate, which is not expired. It returns true when the key pair changed.
+func (r *certificateReloader) reload(logger logr.Logger) (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		// the certificate and key may be read while being written
+		return false, fmt.Errorf("invalid %s key pair in %s and %s: %w", r.name, r.certFile, r.keyFile, err)
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return false, fmt.Errorf("the %s certificate in %s expired on %s", r.name, r.certFile, cert.Leaf.NotAfter)
+	}
+
+	r.cert.Store(&cert)
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+	recordCertificateExpiry(logger, r.name, cert.Leaf)
+	return true, nil
+}
+
+// getCertificate implements tls.Config.GetCertificate
+func (r *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// getClientCertificate implements tls.Config.GetClientCertificate
+func (r *certificateReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// recordCertificateExpiry exports the certificate expiry time, and logs a warning when it expires soon
+func recordCertificateExpiry(logger logr.Logger, name string, cert *x509.Certificate) {
+	certificateExpiry.WithLabelValues(name).Set(float64(cert.NotAfter.Unix()))
+	if remaining := time.Until(cert.NotAfter); remaining < certificateExpiryWarning {
+		logger.Info("warning: certificate expires soon", "certificate", name, "notAfter", cert.NotAfter, "remaining", remaining.String())
+	} else {
+		logger.V(2).Info("loaded certificate", "certificate", name, "notAfter", cert.NotAfter)
+	}
+}
+
+// newServerTLSConfig returns the TLS configuration of the sidecar listener. It serves the key pair of the
+// certificate directory, reloaded when it changes, or a generated certificate, renewed before it expires.
+func (s *Server) newServerTLSConfig(config Config) (*tls.Config, error) {
+	tlsConfig := config.TLSProfile.newTLSConfig()
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+
+	if config.CertPath != "" {
+		cert, err := newCertificateReloader(s.logger, certificateServer, filepath.Join(config.CertPath, "tls.crt"), filepath.Join(config.CertPath, "tls.key"))
+		if err != nil {
+			return nil, err
+		}
+		s.serverCert = cert
+		tlsConfig.GetCertificate = cert.getCertificate
+	} else {
+		issuer, err := newSelfSignedIssuer(s.logger, config.SelfSignedCert)
+		if err != nil {
+			return nil, err
+		}
+		s.selfSigned = issuer
+		tlsConfig.GetCertificate = issuer.getCertificate
+	}
+
+	if err := configureClientAuth(tlsConfig, config); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// watchedFile detects the changes of the content of a file
+type watchedFile struct {
+	path    string
+	content []byte
+}
+
+func newWatchedFile(path string) (*watchedFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &watchedFile{path: path, content: content}, nil
+}
+
+// changed returns true when the file content changed since the last call
+func (f *watchedFile) changed() (bool, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(content, f.content) {
+		return false, nil
+	}
+	f.content = content
+	return true, nil
+}
+
+// watchCertificates reloads the certificates and CA bundles every interval until the context is done
+func (s *Server) watchCertificates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.reloadCertificates()
+	}
+}
+
+// reloadCertificates applies the certificate and CA bundle files which changed, and renews the generated
+// certificate when due. Invalid files are logged and the current ones are kept.
+func (s *Server) reloadCertificates() {
+	if s.selfSigned != nil {
+		if renewed, err := s.selfSigned.renewIfDue(s.logger, time.Now()); err != nil {
+			s.logger.Error(err, "failed to renew the self-signed certificate, keeping the current one")
+		} else if renewed {
+			s.logger.Info("renewed the self-signed certificate", "notAfter", s.selfSigned.cert.Load().Leaf.NotAfter)
+		}
+	}
+	for _, reloader := range []*certificateReloader{s.serverCert, s.prefillerCert} {
+		if reloader == nil {
+			continue
+		}
+		if changed, err := reloader.reload(s.logger); err != nil {
+			s.logger.Error(err, "failed to reload certificate, keeping the current one", "certificate", reloader.name)
+		} else if changed {
+			s.logger.Info("reloaded certificate", "certificate", reloader.name, "path", reloader.certFile)
+		}
+	}
+
+	config := s.currentConfig()
+	if s.clientCA != nil {
+		if changed, err := s.clientCA.changed(); err != nil {
+			s.logger.Error(err, "failed to read the client CA bundle", "path", s.clientCA.path)
+		} else if changed {
+			tlsConfig := s.serverTLSConfig.Load().Clone()
+			if err := configureClientAuth(tlsConfig, config); err != nil {
+				s.logger.Error(err, "failed to reload the client CA bundle, keeping the current one")
+			} else {
+				s.serverTLSConfig.Store(tlsConfig)
+				s.logger.Info("reloaded the client CA bundle", "path", s.clientCA.path)
+			}
+		}
+	}
+
+	if s.prefillerCA != nil {
+		if changed, err := s.prefillerCA.changed(); err != nil {
+			s.logger.Error(err, "failed to read the prefiller CA bundle", "path", s.prefillerCA.path)
+		} else if changed {
+			s.mu.Lock()
+			prefillerTLSConfig, err := newPrefillerTLSConfig(s.config, s.prefillerCert)
+			if err == nil {
+				// new prefiller proxies are created on demand, with the new CA bundle
+				s.prefillerTLSConfig = prefillerTLSConfig
+				s.prefillerProxies.Purge()
+			}
+			s.mu.Unlock()
+			if err != nil {
+				s.logger.Error(err, "failed to reload the prefiller CA bundle, keeping the current one")
+			} else {
+				s.logger.Info("reloaded the prefiller CA bundle", "path", s.prefillerCA.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Certificate rotation", func() {
+	var ca *testCA
+
+	BeforeEach(func() {
+		ca = newTestCA()
+	})
+
+	Context("with a key pair", func() {
+		It("should reload the changed files", func() {
+			_, certFile, keyFile := ca.issue("client", []string{"client"}, nil)
+			reloader, err := newCertificateReloader(logr.Discard(), certificatePrefillerClient, certFile, keyFile)
+			Expect(err).ToNot(HaveOccurred())
+			first, err := reloader.getClientCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(reloader.reload(logr.Discard())).To(BeFalse())
+
+			_, _, _ = ca.issue("client", []string{"client"}, nil)
+			Expect(reloader.reload(logr.Discard())).To(BeTrue())
+			second, err := reloader.getClientCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second.Leaf.SerialNumber).ToNot(Equal(first.Leaf.SerialNumber))
+		})
+
+		It("should keep the current key pair when the new one is invalid or expired", func() {
+			_, certFile, keyFile := ca.issue("client", []string{"client"}, nil)
+			reloader, err := newCertificateReloader(logr.Discard(), certificatePrefillerClient, certFile, keyFile)
+			Expect(err).ToNot(HaveOccurred())
+			current := reloader.cert.Load()
+
+			// the key of another certificate
+			_, _, otherKeyFile := ca.issue("other", []string{"other"}, nil)
+			otherKey, err := os.ReadFile(otherKeyFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(keyFile, otherKey, 0o600)).To(Succeed())
+			_, err = reloader.reload(logr.Discard())
+			Expect(err).To(MatchError(ContainSubstring("invalid prefiller-client key pair")))
+			Expect(reloader.cert.Load()).To(BeIdenticalTo(current))
+
+			_, _, _ = ca.issueUntil("client", time.Now().Add(-time.Minute), []string{"client"}, nil)
+			_, err = reloader.reload(logr.Discard())
+			Expect(err).To(MatchError(ContainSubstring("expired")))
+			Expect(reloader.cert.Load()).To(BeIdenticalTo(current))
+		})
+
+		It("should export the certificate expiry time", func() {
+			notAfter := time.Now().Add(72 * time.Hour).Truncate(time.Second)
+			_, certFile, keyFile := ca.issueUntil("client", notAfter, []string{"client"}, nil)
+			_, err := newCertificateReloader(logr.Discard(), certificatePrefillerClient, certFile, keyFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(testutil.ToFloat64(certificateExpiry.WithLabelValues(certificatePrefillerClient))).To(Equal(float64(notAfter.Unix())))
+		})
+	})
+
+	Context("with the secure proxy", func() {
+		var (
+			proxy     *Server
+			proxyAddr string
+			clientCA  string
+		)
+
+		BeforeEach(func() {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			DeferCleanup(decoder.Close)
+			decoderURL, err := url.Parse(decoder.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _ = ca.issue("tls", []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)})
+			clientCA = filepath.Join(GinkgoT().TempDir(), "client-ca.crt")
+			bundle, err := os.ReadFile(ca.bundle())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(clientCA, bundle, 0o600)).To(Succeed())
+
+			proxy, err = NewProxy("0", decoderURL, Config{SecureProxy: true, CertPath: ca.dir, ClientCAFile: clientCA})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			waitForProxy(proxy)
+			proxyAddr = fmt.Sprintf("https://localhost:%d", proxy.addr.(*net.TCPAddr).Port)
+		})
+
+		// get returns the status code and the certificate served by the proxy, on a new connection
+		get := func(certs ...tls.Certificate) (int, *x509.Certificate, error) {
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+				DisableKeepAlives: true,
+			}}
+			resp, err := client.Get(proxyAddr + "/v1/models")
+			if err != nil {
+				return 0, nil, err
+			}
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode, resp.TLS.PeerCertificates[0], nil
+		}
+
+		It("should serve the rotated certificate and keep the current one when invalid", func() {
+			gateway, _, _ := ca.issue("gateway", []string{"gateway"}, nil)
+			_, first, err := get(gateway)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _ = ca.issue("tls", []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)})
+			proxy.reloadCertificates()
+			_, second, err := get(gateway)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second.SerialNumber).ToNot(Equal(first.SerialNumber))
+
+			Expect(os.WriteFile(filepath.Join(ca.dir, "tls.crt"), []byte("invalid"), 0o600)).To(Succeed())
+			proxy.reloadCertificates()
+			_, third, err := get(gateway)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(third.SerialNumber).To(Equal(second.SerialNumber))
+		})
+
+		It("should verify the client certificates with the rotated CA bundle", func() {
+			other := newTestCA()
+			gateway, _, _ := other.issue("gateway", []string{"gateway"}, nil)
+			_, _, err := get(gateway)
+			Expect(err).To(HaveOccurred())
+
+			bundle, err := os.ReadFile(other.bundle())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(clientCA, bundle, 0o600)).To(Succeed())
+			proxy.reloadCertificates()
+			Expect(get(gateway)).Error().ToNot(HaveOccurred())
+		})
+	})
+})
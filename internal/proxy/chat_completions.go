@@ -17,7 +17,15 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -29,30 +37,119 @@ var (
 )
 
 func (s *Server) chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
-	prefillPodHostPort := r.Header.Get(requestHeaderPrefillHostPort)
+	start := time.Now()
 
-	if prefillPodHostPort == "" {
-		// backward compatible behavior: to remove in next release
-		prefillPodHostPort = r.Header.Get(requestHeaderPrefillURL)
+	ctx, span := tracer().Start(extractTraceContext(r), spanNameRequest,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			attributeConnector.String(s.currentConfig().Connector),
+		))
+	defer span.End()
+
+	// Reuse the incoming request ID, if any, so that gateway, sidecar and vLLM logs can be joined
+	id, err := requestID(r)
+	if err != nil {
+		if err := writeError(w, http.StatusInternalServerError, errorCodeRequestInternal, "", err); err != nil {
+			s.logger.Error(err, "failed to send error response to client")
+		}
+		s.recordRequest(r, outcomeError, start)
+		return
+	}
+	r.Header.Set(requestHeaderRequestID, id)
+	w.Header().Set(requestHeaderRequestID, id)
+
+	logger := s.logger.WithValues("requestID", id)
+	ctx = klog.NewContext(ctx, logger)
+
+	// Honor the client deadline, if any, in both the prefill and decode stages
+	deadline, ok, err := requestDeadline(r)
+	if err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		s.recordRequest(r, outcomeError, start)
+		return
 	}
+	if ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+		if ctx.Err() != nil {
+			if err := writeError(w, http.StatusGatewayTimeout, errorCodeRequestDeadlineExceeded, "", errors.New("request deadline exceeded")); err != nil {
+				logger.Error(err, "failed to send error response to client")
+			}
+			s.recordRequest(r, outcomeTimeout, start)
+			return
+		}
+	}
+	r = r.WithContext(ctx)
 
-	if prefillPodHostPort == "" {
-		s.logger.V(4).Info("skip disaggregated prefill")
-		s.decoderProxy.ServeHTTP(w, r)
+	if limit := s.currentConfig().MaxRequestBodySize; !limitRequestBody(w, r, limit) {
+		if err := writeError(w, http.StatusRequestEntityTooLarge, errorCodeRequestTooLarge, "", errBodyTooLarge(limit)); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		s.recordRequest(r, outcomeError, start)
 		return
 	}
 
-	// SSRF Protection: Check if the prefill target is allowed
-	if !s.allowlistValidator.IsAllowed(prefillPodHostPort) {
-		s.logger.Error(nil, "SSRF protection: prefill target not in allowlist",
-			"target", prefillPodHostPort,
-			"clientIP", r.RemoteAddr,
-			"userAgent", r.Header.Get("User-Agent"),
-			"requestPath", r.URL.Path)
-		http.Error(w, "Forbidden: prefill target not allowed by SSRF protection", http.StatusForbidden)
+	prefillHostPorts := prefillCandidates(r)
+	if len(prefillHostPorts) == 0 {
+		logger.V(4).Info("skip disaggregated prefill")
+		s.serveDecode(w, r)
+		s.recordRequest(r, outcomePassthrough, start)
 		return
 	}
 
-	s.logger.V(4).Info("SSRF protection: prefill target allowed", "target", prefillPodHostPort)
-	s.runConnectorProtocol(w, r, prefillPodHostPort)
+	// SSRF Protection: Check the prefill targets are allowed
+	allowed := make([]string, 0, len(prefillHostPorts))
+	for _, prefillHostPort := range prefillHostPorts {
+		if !s.allowlistValidator.IsAllowed(ctx, prefillHostPort) {
+			logger.Error(nil, "SSRF protection: prefill target not in allowlist",
+				"target", prefillHostPort,
+				"clientIP", r.RemoteAddr,
+				"userAgent", r.Header.Get("User-Agent"),
+				"requestPath", r.URL.Path)
+			continue
+		}
+		allowed = append(allowed, prefillHostPort)
+	}
+	if len(allowed) == 0 {
+		if err := writeError(w, http.StatusForbidden, errorCodeRequestSSRFRejected, "", errors.New("prefill target not allowed by SSRF protection")); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		s.recordRequest(r, outcomeSSRFRejected, start)
+		return
+	}
+
+	logger.V(4).Info("SSRF protection: prefill targets allowed", "targets", allowed)
+	outcome := s.runConnectorProtocol(w, r, allowed)
+	s.recordRequest(r, outcome, start)
+}
+
+// prefillCandidates returns the ordered, de-duplicated list of prefill targets of the request.
+// The x-prefiller-host-port header accepts a comma-separated list of host:port, followed by
+// the ones listed in x-prefiller-alternate-host-ports.
+func prefillCandidates(r *http.Request) []string {
+	values := r.Header.Values(requestHeaderPrefillHostPort)
+	if len(values) == 0 {
+		// backward compatible behavior: to remove in next release
+		values = r.Header.Values(requestHeaderPrefillURL)
+	}
+	values = append(values, r.Header.Values(requestHeaderPrefillAlternates)...)
+
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, candidate := range strings.Split(value, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "" || seen[candidate] {
+				continue
+			}
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
 }
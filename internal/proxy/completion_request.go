@@ -0,0 +1,269 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CompletionRequest is the body of a completions or chat completions request, rewritten by the connectors.
+// Only the fields which are set or deleted are encoded again: the other ones are kept byte for byte, in their
+// original order and layout, so that numbers beyond the float64 precision, such as seeds and token IDs, are preserved.
+type CompletionRequest struct {
+	original []byte
+	members  []requestMember
+	trailer  []byte // the whitespace before the closing brace
+	edited   bool
+}
+
+// requestMember is a member of the request JSON object
+type requestMember struct {
+	key   string
+	value json.RawMessage
+	lead  []byte // the whitespace before the member
+	raw   []byte // the original bytes of the member, from its key to its value, nil once edited
+}
+
+// jsonWhitespace are the insignificant whitespace characters of JSON
+const jsonWhitespace = " \t\r\n"
+
+// ParseCompletionRequest parses a request body, which must be a JSON object. The members refer to the body,
+// which must not be modified afterwards.
+func ParseCompletionRequest(body []byte) (*CompletionRequest, error) {
+	if !json.Valid(body) {
+		var v json.RawMessage
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err // reports the syntax error
+		}
+		return nil, errors.New("invalid request body")
+	}
+	i := skipWhitespace(body, 0)
+	if body[i] != '{' {
+		return nil, errors.New("the request body must be a JSON object")
+	}
+
+	// the body being valid JSON, the members are delimited without checking their syntax again
+	r := &CompletionRequest{original: body}
+	offset := i + 1 // the end of the previous value
+	for {
+		i = skipWhitespace(body, offset)
+		if body[i] == '}' {
+			break
+		}
+		if body[i] == ',' {
+			i = skipWhitespace(body, i+1)
+		}
+		start := i
+		keyEnd := skipString(body, i)
+		key, err := decodeKey(body[start:keyEnd])
+		if err != nil {
+			return nil, err
+		}
+		valueStart := skipWhitespace(body, skipWhitespace(body, keyEnd)+1) // after the colon
+		valueEnd := skipValue(body, valueStart)
+
+		lead := body[offset:start] // the whitespace following the separator
+		if comma := bytes.IndexByte(lead, ','); comma >= 0 {
+			lead = lead[comma+1:]
+		}
+		r.members = append(r.members, requestMember{
+			key:   key,
+			value: json.RawMessage(body[valueStart:valueEnd]),
+			lead:  lead,
+			raw:   body[start:valueEnd],
+		})
+		offset = valueEnd
+	}
+	r.trailer = body[offset:i]
+	return r, nil
+}
+
+// skipWhitespace returns the index of the first non-whitespace character from i
+func skipWhitespace(body []byte, i int) int {
+	for i < len(body) && strings.IndexByte(jsonWhitespace, body[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// skipString returns the index following the JSON string starting at i
+func skipString(body []byte, i int) int {
+	for i++; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
+
+// skipValue returns the index following the JSON value starting at i
+func skipValue(body []byte, i int) int {
+	switch body[i] {
+	case '"':
+		return skipString(body, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(body); i++ {
+			switch body[i] {
+			case '"':
+				i = skipString(body, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return i
+	default: // number, true, false or null
+		for i < len(body) && strings.IndexByte(jsonWhitespace+",}]", body[i]) < 0 {
+			i++
+		}
+		return i
+	}
+}
+
+// decodeKey decodes a member key, only unescaping it when needed
+func decodeKey(raw []byte) (string, error) {
+	if bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1]), nil
+	}
+	var key string
+	err := json.Unmarshal(raw, &key)
+	return key, err
+}
+
+// index returns the index of the member with the given key, the last one when duplicated, or -1
+func (r *CompletionRequest) index(key string) int {
+	for i := len(r.members) - 1; i >= 0; i-- {
+		if r.members[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has returns true when the request has the given field
+func (r *CompletionRequest) Has(key string) bool {
+	return r.index(key) >= 0
+}
+
+// Get decodes the value of the given field into v. It returns false when the request does not have the field.
+func (r *CompletionRequest) Get(key string, v any) (bool, error) {
+	i := r.index(key)
+	if i < 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(r.members[i].value, v); err != nil {
+		return true, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Set sets the given field to the JSON encoding of v, replacing its current value, if any, in place.
+// A json.RawMessage value is set as is.
+func (r *CompletionRequest) Set(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	r.edited = true
+	i := r.index(key)
+	if i < 0 {
+		// new fields follow the layout of the last one
+		var lead []byte
+		if len(r.members) > 0 {
+			lead = r.members[len(r.members)-1].lead
+		}
+		r.members = append(r.members, requestMember{key: key, value: value, lead: lead})
+		return nil
+	}
+	r.members[i] = requestMember{key: key, value: value, lead: r.members[i].lead}
+	r.deleteBefore(key, i)
+	return nil
+}
+
+// Delete removes the given field
+func (r *CompletionRequest) Delete(key string) {
+	if i := r.index(key); i >= 0 {
+		r.edited = true
+		r.members = append(r.members[:i], r.members[i+1:]...)
+		r.deleteBefore(key, i)
+	}
+}
+
+// deleteBefore removes the duplicates of the given field before the index, which would be ignored anyway
+func (r *CompletionRequest) deleteBefore(key string, index int) {
+	members := r.members[:0]
+	for i, member := range r.members {
+		if i >= index || member.key != key {
+			members = append(members, member)
+		}
+	}
+	r.members = members
+}
+
+// Bytes returns the request body. It is the original body when no field was edited.
+func (r *CompletionRequest) Bytes() []byte {
+	if !r.edited {
+		return r.original
+	}
+	var buf bytes.Buffer
+	r.writeTo(&buf)
+	return buf.Bytes()
+}
+
+// requestBody returns the request body in a pooled buffer, sharing the original one when no field was edited.
+// The original must be the body the request was parsed from. The returned body must be released by the caller.
+func (r *CompletionRequest) requestBody(original *requestBody) *requestBody {
+	if !r.edited {
+		return original.retain()
+	}
+	b := newRequestBody()
+	r.writeTo(b.buf)
+	return b
+}
+
+// writeTo writes the edited request body to the buffer
+func (r *CompletionRequest) writeTo(buf *bytes.Buffer) {
+	buf.Grow(len(r.original) + 64)
+	buf.WriteByte('{')
+	for i, member := range r.members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(member.lead)
+		if member.raw != nil {
+			buf.Write(member.raw)
+			continue
+		}
+		key, _ := json.Marshal(member.key) // strings are always encoded
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(member.value)
+	}
+	buf.Write(r.trailer)
+	buf.WriteByte('}')
+}
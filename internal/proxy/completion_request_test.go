@@ -0,0 +1,180 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files under testdata")
+
+var _ = Describe("Completion request", func() {
+	It("should keep the original body when no field is edited", func() {
+		body := []byte(`{ "model" : "m",  "seed": 18446744073709551615, "prompt": [1, 2] }`)
+		request, err := ParseCompletionRequest(body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request.Bytes()).To(Equal(body))
+	})
+
+	It("should keep the layout of pretty-printed bodies", func() {
+		request, err := ParseCompletionRequest([]byte("{\n  \"model\": \"m\",\n  \"stream\": true\n}\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request.Set(requestFieldMaxTokens, 1)).To(Succeed())
+		Expect(string(request.Bytes())).To(Equal("{\n  \"model\": \"m\",\n  \"stream\": true,\n  \"max_tokens\":1\n}"))
+	})
+
+	It("should only encode again the edited fields", func() {
+		request, err := ParseCompletionRequest([]byte(`{"a": 1.50, "stream": true, "b": "<x>", "max_tokens": 10, "c": 18446744073709551615}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(request.Set(requestFieldStream, false)).To(Succeed())
+		request.Delete(requestFieldMaxTokens)
+		Expect(request.Set(requestFieldKVTransferParams, json.RawMessage(`{"x":[1]}`))).To(Succeed())
+
+		Expect(string(request.Bytes())).To(Equal(`{"a": 1.50, "stream":false, "b": "<x>", "c": 18446744073709551615, "kv_transfer_params":{"x":[1]}}`))
+	})
+
+	It("should delimit nested and escaped members", func() {
+		body := `{"prompt": "} ] \\\" {", "messages": [{"content": "[{\"}"}, {}], "str\u0065am": true, "logprobs": null,"n":-1.5e3}`
+		request, err := ParseCompletionRequest([]byte(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		var prompt string
+		Expect(request.Get("prompt", &prompt)).To(BeTrue())
+		Expect(prompt).To(Equal(`} ] \" {`))
+		var messages []map[string]string
+		Expect(request.Get("messages", &messages)).To(BeTrue())
+		Expect(messages).To(Equal([]map[string]string{{"content": `[{"}`}, {}}))
+		Expect(request.Has(requestFieldStream)).To(BeTrue())
+		var n float64
+		Expect(request.Get("n", &n)).To(BeTrue())
+		Expect(n).To(Equal(-1500.0))
+
+		Expect(request.Set(requestFieldStream, false)).To(Succeed())
+		Expect(string(request.Bytes())).To(Equal(`{"prompt": "} ] \\\" {", "messages": [{"content": "[{\"}"}, {}], "stream":false, "logprobs": null,"n":-1.5e3}`))
+	})
+
+	It("should get the fields", func() {
+		request, err := ParseCompletionRequest([]byte(`{"stream": true, "n": "2"}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		var stream bool
+		Expect(request.Get(requestFieldStream, &stream)).To(BeTrue())
+		Expect(stream).To(BeTrue())
+
+		var n int
+		found, err := request.Get("n", &n)
+		Expect(found).To(BeTrue())
+		Expect(err).To(MatchError(ContainSubstring("invalid n")))
+
+		Expect(request.Has(requestFieldMaxTokens)).To(BeFalse())
+		Expect(request.Get(requestFieldMaxTokens, &n)).To(BeFalse())
+	})
+
+	It("should keep the last duplicated field", func() {
+		request, err := ParseCompletionRequest([]byte(`{"stream": true, "model": "m", "stream": false}`))
+		Expect(err).ToNot(HaveOccurred())
+
+		var stream bool
+		Expect(request.Get(requestFieldStream, &stream)).To(BeTrue())
+		Expect(stream).To(BeFalse())
+
+		Expect(request.Set(requestFieldStream, true)).To(Succeed())
+		Expect(string(request.Bytes())).To(Equal(`{ "model": "m", "stream":true}`))
+
+		request.Delete(requestFieldStream)
+		Expect(request.Has(requestFieldStream)).To(BeFalse())
+		Expect(string(request.Bytes())).To(Equal(`{ "model": "m"}`))
+	})
+
+	DescribeTable("should reject invalid bodies",
+		func(body string) {
+			_, err := ParseCompletionRequest([]byte(body))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("empty", ``),
+		Entry("array", `[{"model":"m"}]`),
+		Entry("string", `"model"`),
+		Entry("truncated", `{"model":"m"`),
+		Entry("trailing data", `{"model":"m"} {}`),
+		Entry("invalid value", `{"model":m}`),
+	)
+})
+
+var _ = Describe("Connector request rewriting", func() {
+	prefillerResponses := map[string]string{
+		ConnectorNIXLV1:  `{"id":"cmpl-1","remote_block_ids":[1,2,9007199254740993],"remote_engine_id":"e","remote_host":"10.0.0.1","remote_port":5600}`,
+		ConnectorNIXLV2:  `{"id":"cmpl-1","kv_transfer_params":{"remote_engine_id":"e","remote_block_ids":[1,2,9007199254740993],"remote_host":"10.0.0.1","remote_port":5600,"tp_size":1}}`,
+		ConnectorLMCache: `{"id":"cmpl-1"}`,
+	}
+
+	// golden compares the rewritten body with the golden file, or updates it with -update
+	golden := func(path string, body []byte) {
+		if *updateGolden {
+			Expect(os.WriteFile(path, body, 0o644)).To(Succeed())
+			return
+		}
+		expected, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(string(expected)), "body differs from %s, run the tests with -update to regenerate it", path)
+	}
+
+	DescribeTable("should only rewrite the fields owned by the connector",
+		func(connectorName string) {
+			ctx := context.Background()
+			connector, err := NewConnector(connectorName, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			requests, err := filepath.Glob(filepath.Join("testdata", "requests", "*.json"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requests).ToNot(BeEmpty())
+
+			for _, path := range requests {
+				original, err := os.ReadFile(path)
+				Expect(err).ToNot(HaveOccurred())
+				prefix := strings.TrimSuffix(path, ".json") + "." + connectorName
+				req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+
+				prefillRequest, err := ParseCompletionRequest(original)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connector.PreparePrefill(ctx, req, prefillRequest)).To(Succeed())
+				golden(prefix+".prefill.golden", prefillRequest.Bytes())
+
+				prefillState, err := connector.InterpretPrefillResponse(ctx, []byte(prefillerResponses[connectorName]))
+				Expect(err).ToNot(HaveOccurred())
+
+				decodeRequest, err := ParseCompletionRequest(original)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connector.PrepareDecode(ctx, req, decodeRequest, prefillState)).To(Succeed())
+				golden(prefix+".decode.golden", decodeRequest.Bytes())
+			}
+		},
+		Entry(ConnectorNIXLV1, ConnectorNIXLV1),
+		Entry(ConnectorNIXLV2, ConnectorNIXLV2),
+		Entry(ConnectorLMCache, ConnectorLMCache),
+	)
+})
@@ -0,0 +1,188 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Connector implements a P/D KV transfer protocol.
+//
+// The proxy drives a disaggregated request through the connector hooks in order:
+// PreparePrefill, InterpretPrefillResponse and PrepareDecode. Each hook receives
+// its own copy of the parsed completion request, so connectors must not keep
+// per-request state outside of the value returned by InterpretPrefillResponse.
+type Connector interface {
+	// PreparePrefill rewrites the request sent to the prefiller.
+	// completionRequest is the parsed client request body and is encoded back
+	// as the prefill request body once the hook returns.
+	PreparePrefill(ctx context.Context, preq *http.Request, completionRequest *CompletionRequest) error
+
+	// InterpretPrefillResponse extracts the P/D state from a successful prefiller
+	// response body. The returned value is passed as is to PrepareDecode.
+	InterpretPrefillResponse(ctx context.Context, prefillerResponse []byte) (map[string]any, error)
+
+	// PrepareDecode rewrites the request sent to the local decoder.
+	// completionRequest is a fresh copy of the parsed client request body.
+	PrepareDecode(ctx context.Context, dreq *http.Request, completionRequest *CompletionRequest, prefillState map[string]any) error
+}
+
+// InvalidPrefillResponseError is returned by Connector.InterpretPrefillResponse when the prefiller
+// response does not carry a valid P/D state. The request fails with a 502 error, or falls back to
+// local prefill when Fallback is set.
+type InvalidPrefillResponseError struct {
+	// Param is the invalid field of the prefiller response, e.g. kv_transfer_params.
+	Param string
+
+	// Fallback requests the local decoder to perform the prefill.
+	Fallback bool
+
+	Err error
+}
+
+func (e *InvalidPrefillResponseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidPrefillResponseError) Unwrap() error {
+	return e.Err
+}
+
+// PrefillAborter is implemented by connectors able to release the KV cache held by a prefiller
+// when the decode stage does not run, for instance because the client disconnected.
+type PrefillAborter interface {
+	// PrepareAbort rewrites the request releasing the prefill state on the prefiller and returns its body.
+	// areq is a copy of the client request, sent to the prefiller which served the prefill.
+	// A nil body means there is nothing to release.
+	PrepareAbort(ctx context.Context, areq *http.Request, prefillState map[string]any) (map[string]any, error)
+}
+
+// ConnectorFactory creates a Connector from the connector-specific options.
+// Factories are expected to validate their options and return an error
+// when they are invalid.
+type ConnectorFactory func(options map[string]string) (Connector, error)
+
+// ConnectorRegistration describes a registered Connector.
+type ConnectorRegistration struct {
+	// Description is a short, human readable description of the connector.
+	Description string
+
+	// Deprecated marks the connector as deprecated.
+	Deprecated bool
+
+	// Options lists the option names accepted by the connector, with their description.
+	Options map[string]string
+
+	// Factory creates the connector.
+	Factory ConnectorFactory
+}
+
+var (
+	connectorsMu sync.RWMutex
+	connectors   = map[string]ConnectorRegistration{}
+)
+
+// RegisterConnector registers a connector under the given name.
+// It panics when the name is empty, already registered or the factory is nil.
+func RegisterConnector(name string, registration ConnectorRegistration) {
+	connectorsMu.Lock()
+	defer connectorsMu.Unlock()
+
+	if name == "" {
+		panic("proxy: connector name must not be empty")
+	}
+	if registration.Factory == nil {
+		panic("proxy: nil factory for connector " + name)
+	}
+	if _, exists := connectors[name]; exists {
+		panic("proxy: connector " + name + " already registered")
+	}
+	connectors[name] = registration
+}
+
+// LookupConnector returns the registration of the named connector.
+func LookupConnector(name string) (ConnectorRegistration, bool) {
+	connectorsMu.RLock()
+	defer connectorsMu.RUnlock()
+
+	registration, ok := connectors[name]
+	return registration, ok
+}
+
+// RegisteredConnectors returns the sorted names of all registered connectors.
+func RegisteredConnectors() []string {
+	connectorsMu.RLock()
+	defer connectorsMu.RUnlock()
+
+	names := make([]string, 0, len(connectors))
+	for name := range connectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewConnector creates the named connector, validating its options.
+func NewConnector(name string, options map[string]string) (Connector, error) {
+	registration, ok := LookupConnector(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown connector %q (registered connectors: %v)", name, RegisteredConnectors())
+	}
+
+	for option := range options {
+		if _, ok := registration.Options[option]; !ok {
+			return nil, fmt.Errorf("connector %q does not support option %q", name, option)
+		}
+	}
+
+	connector, err := registration.Factory(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration for connector %q: %w", name, err)
+	}
+	return connector, nil
+}
+
+func init() {
+	RegisterConnector(ConnectorNIXLV1, ConnectorRegistration{
+		Description: "P/D NIXL v1 protocol",
+		Deprecated:  true,
+		Factory: func(map[string]string) (Connector, error) {
+			return &nixlV1Connector{}, nil
+		},
+	})
+	RegisterConnector(ConnectorNIXLV2, ConnectorRegistration{
+		Description: "P/D NIXL v2 protocol",
+		Options: map[string]string{
+			nixlV2OptionAbortPath: "path of the prefiller endpoint releasing the KV cache of requests which are not decoded, " +
+				"e.g. /v1/kv_transfer/abort. The prefiller must implement it. Disabled when empty (default)",
+			nixlV2OptionInvalidParamsPolicy: "what to do when the prefiller returns missing or invalid kv_transfer_params: " + kvParamsPolicyFallback +
+				" (default, local prefill), " + kvParamsPolicyReject + " (502 error) or " + kvParamsPolicyPassthrough + " (sent as is to the decoder)",
+		},
+		Factory: newNIXLV2Connector,
+	})
+	RegisterConnector(ConnectorLMCache, ConnectorRegistration{
+		Description: "P/D LMCache protocol",
+		Deprecated:  true,
+		Factory: func(map[string]string) (Connector, error) {
+			return &lmcacheConnector{}, nil
+		},
+	})
+}
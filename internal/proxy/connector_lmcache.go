@@ -17,72 +17,27 @@ limitations under the License.
 package proxy
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"net/http"
-	"strings"
 )
 
-func (s *Server) runLMCacheProtocol(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
-	s.logger.Info("running LMCache protocol")
+// lmcacheConnector implements the (now deprecated) P/D LMCache protocol
+type lmcacheConnector struct{}
 
-	// Read and parse request body
-	defer r.Body.Close() //nolint:all
-	original, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
-		return
-	}
-
-	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
-
-	// Create prefiller request. Set max_tokens to 1.
-
-	ctx := r.Context()
-	preq := r.Clone(ctx)
-
-	completionRequest["max_tokens"] = 1
-	completionRequest["max_completion_tokens"] = 1
-
-	pbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
-
-	// Forward request to prefiller
-
-	prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
-
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
-
-	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
-		return
+// PreparePrefill sets max_tokens to 1.
+func (c *lmcacheConnector) PreparePrefill(_ context.Context, _ *http.Request, completionRequest *CompletionRequest) error {
+	if err := completionRequest.Set(requestFieldMaxTokens, 1); err != nil {
+		return err
 	}
+	return completionRequest.Set(requestFieldMaxCompletionTokens, 1)
+}
 
-	// Forward original request to local decoder
+// InterpretPrefillResponse ignores the prefiller response: the KV cache is shared through LMCache.
+func (c *lmcacheConnector) InterpretPrefillResponse(context.Context, []byte) (map[string]any, error) {
+	return nil, nil
+}
 
-	r.Body = io.NopCloser(strings.NewReader(string(original)))
-	s.decoderProxy.ServeHTTP(w, r)
+// PrepareDecode forwards the original request to the local decoder.
+func (c *lmcacheConnector) PrepareDecode(context.Context, *http.Request, *CompletionRequest, map[string]any) error {
+	return nil
 }
@@ -17,162 +17,73 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
 	"encoding/json"
-	"io"
 	"net/http"
-	"strings"
 
-	"github.com/google/uuid"
+	"k8s.io/klog/v2"
 )
 
-func (s *Server) runNIXLProtocolV1(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
-	s.logger.Info("running NIXL protocol V1")
-
-	// Read request body
-	defer r.Body.Close() //nolint:all
-	original, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
-		return
-	}
-
-	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
-
-	// Generate unique request UUID
-	uuid, err := uuid.NewUUID()
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
-	uuidStr := uuid.String()
-
-	// Send request to prefill pod
-
-	// 1. Prepare request
-	ctx := r.Context()
-	preq := r.Clone(ctx)
-
-	preq.Header.Add(requestHeaderRequestID, uuidStr)
-
-	streamValue, streamOk := completionRequest[requestFieldStream]
-	streamOptionsValue, streamOptionsOk := completionRequest[requestFieldStreamOptions]
+// nixlV1StateFields are the prefiller response fields sent to the decoder, in order
+var nixlV1StateFields = []string{
+	requestFieldRemoteBlockIDs,
+	requestFieldRemoteEngineID,
+	requestFieldRemoteHost,
+	requestFieldRemotePort,
+}
 
-	completionRequest[requestFieldDoRemoteDecode] = true
-	completionRequest[requestFieldStream] = false
-	delete(completionRequest, requestFieldStreamOptions)
+// nixlV1Connector implements the (now deprecated) P/D NIXL v1 protocol
+type nixlV1Connector struct{}
 
-	pbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+func (c *nixlV1Connector) PreparePrefill(_ context.Context, _ *http.Request, completionRequest *CompletionRequest) error {
+	if err := completionRequest.Set(requestFieldDoRemoteDecode, true); err != nil {
+		return err
 	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
-
-	prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+	if err := completionRequest.Set(requestFieldStream, false); err != nil {
+		return err
 	}
+	completionRequest.Delete(requestFieldStreamOptions)
+	return nil
+}
 
-	// 2. Forward request to prefiller
-	s.logger.V(5).Info("sending request to prefiller", "hostPort", prefillPodHostPort, "body", string(pbody))
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
-
-	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
-		return
-	}
+func (c *nixlV1Connector) InterpretPrefillResponse(ctx context.Context, prefillerResponse []byte) (map[string]any, error) {
+	logger := klog.FromContext(ctx)
 
 	// Process response - extract p/d fields
-	var prefillerResponse map[string]any
-	if err := json.Unmarshal([]byte(pw.buffer.String()), &prefillerResponse); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(prefillerResponse, &response); err != nil {
+		return nil, err
 	}
 
-	// 1. Verify fields exists
-
-	blockIDs, ok := prefillerResponse[requestFieldRemoteBlockIDs]
-	if !ok {
-		// TODO: error or ignore?
-		s.logger.Info("warning: missing 'remote_block_ids' field in prefiller response")
-	}
-
-	engineID, ok := prefillerResponse[requestFieldRemoteEngineID]
-	if !ok {
-		// TODO: error or ignore?
-		s.logger.Info("warning: missing 'remote_engine_id' field in prefiller response")
-	}
-
-	remoteHost, ok := prefillerResponse[requestFieldRemoteHost]
-	if !ok {
-		// TODO: error or ignore?
-		s.logger.Info("warning: missing 'remote_host' field in prefiller response")
-	}
-
-	remotePort, ok := prefillerResponse[requestFieldRemotePort]
-	if !ok {
-		// TODO: error or ignore?
-		s.logger.Info("warning: missing 'remote_port' field in prefiller response")
+	// the values are sent as is to the decoder
+	prefillState := make(map[string]any, 4)
+	keysAndValues := make([]any, 0, 8)
+	for _, field := range nixlV1StateFields {
+		value, ok := response[field]
+		if !ok {
+			// TODO: error or ignore?
+			logger.Info("warning: missing '" + field + "' field in prefiller response")
+			prefillState[field] = nil
+			keysAndValues = append(keysAndValues, field, nil)
+			continue
+		}
+		prefillState[field] = value
+		keysAndValues = append(keysAndValues, field, string(value))
 	}
 
-	s.logger.Info("received prefiller response",
-		requestFieldRemoteBlockIDs, blockIDs,
-		requestFieldRemoteEngineID, engineID,
-		requestFieldRemoteHost, remoteHost,
-		requestFieldRemotePort, remotePort,
-	)
+	logger.Info("received prefiller response", keysAndValues...)
 
-	// 2. Prepare decode request
-	dreq := r.Clone(ctx)
-
-	dreq.Header.Add(requestHeaderRequestID, uuidStr)
+	return prefillState, nil
+}
 
-	delete(completionRequest, requestFieldDoRemoteDecode)
-	delete(completionRequest, requestFieldStream)
-	if streamOk {
-		completionRequest[requestFieldStream] = streamValue
+func (c *nixlV1Connector) PrepareDecode(_ context.Context, _ *http.Request, completionRequest *CompletionRequest, prefillState map[string]any) error {
+	if err := completionRequest.Set(requestFieldDoRemotePrefill, true); err != nil {
+		return err
 	}
-	if streamOptionsOk {
-		completionRequest[requestFieldStreamOptions] = streamOptionsValue
-	}
-
-	completionRequest[requestFieldDoRemotePrefill] = true
-	completionRequest[requestFieldRemoteBlockIDs] = blockIDs
-	completionRequest[requestFieldRemoteEngineID] = engineID
-	completionRequest[requestFieldRemoteHost] = remoteHost
-	completionRequest[requestFieldRemotePort] = remotePort
-
-	dbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+	for _, field := range nixlV1StateFields {
+		if err := completionRequest.Set(field, prefillState[field]); err != nil {
+			return err
 		}
-		return
 	}
-	dreq.Body = io.NopCloser(strings.NewReader(string(dbody)))
-	dreq.ContentLength = int64(len(dbody))
-
-	// 3. Forward to local decoder.
-	s.logger.V(5).Info("sending request to decoder", "body", string(dbody))
-	s.decoderProxy.ServeHTTP(w, dreq)
+	return nil
 }
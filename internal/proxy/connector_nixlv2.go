@@ -17,149 +17,139 @@ limitations under the License.
 package proxy
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
-	"github.com/google/uuid"
+	"k8s.io/klog/v2"
 )
 
-func (s *Server) runNIXLProtocolV2(w http.ResponseWriter, r *http.Request, prefillPodHostPort string) {
-	s.logger.V(4).Info("running NIXL protocol V2", "url", prefillPodHostPort)
+const (
+	nixlV2OptionAbortPath           = "abort-path"
+	nixlV2OptionInvalidParamsPolicy = "invalid-params-policy"
+)
 
-	// Read request body
-	defer r.Body.Close() //nolint:all
-	original, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest) // TODO: check FastAPI error code when failing to read body
-		w.Write([]byte(err.Error()))         //nolint:all
-		return
-	}
+// nixlV2PrefillLimits are the fields bounding the number of generated tokens or samples, overridden in the prefill
+// request when set by the client so that the prefiller generates a single token. The decode request keeps them.
+var nixlV2PrefillLimits = []struct {
+	field string
+	value int
+}{
+	{requestFieldMaxCompletionTokens, 1},
+	{requestFieldMinTokens, 0},
+	{requestFieldN, 1},
+	{requestFieldBestOf, 1},
+}
 
-	// Parse completion request
-	var completionRequest map[string]any
-	if err := json.Unmarshal(original, &completionRequest); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
-	}
+// nixlV2Connector implements the P/D NIXL v2 protocol
+type nixlV2Connector struct {
+	abortPath           string
+	invalidParamsPolicy string // applied to prefiller responses with invalid kv_transfer_params
+}
 
-	// Generate unique request UUID
-	uuid, err := uuid.NewUUID()
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+func newNIXLV2Connector(options map[string]string) (Connector, error) {
+	// vLLM does not serve an abort endpoint: the abort request is only sent when the prefiller implements one
+	abortPath := options[nixlV2OptionAbortPath]
+	if abortPath != "" && !strings.HasPrefix(abortPath, "/") {
+		return nil, fmt.Errorf("%s must be an absolute path, got %q", nixlV2OptionAbortPath, abortPath)
 	}
-	uuidStr := uuid.String()
-
-	// Prefill Stage
-
-	// 1. Prepare prefill request
-	ctx := r.Context()
-	preq := r.Clone(ctx)
-
-	preq.Header.Add(requestHeaderRequestID, uuidStr)
-
-	streamValue, streamOk := completionRequest[requestFieldStream]
-	streamOptionsValue, streamOptionsOk := completionRequest[requestFieldStreamOptions]
-	maxTokensValue, maxTokensOk := completionRequest[requestFieldMaxTokens]
+	policy := options[nixlV2OptionInvalidParamsPolicy]
+	switch policy {
+	case "":
+		// the decoder performs the prefill, as it would with the invalid parameters, but predictably
+		policy = kvParamsPolicyFallback
+	case kvParamsPolicyReject, kvParamsPolicyFallback, kvParamsPolicyPassthrough:
+	default:
+		return nil, fmt.Errorf("%s must be one of %s, %s or %s, got %q", nixlV2OptionInvalidParamsPolicy,
+			kvParamsPolicyReject, kvParamsPolicyFallback, kvParamsPolicyPassthrough, policy)
+	}
+	return &nixlV2Connector{abortPath: abortPath, invalidParamsPolicy: policy}, nil
+}
 
-	completionRequest[requestFieldKVTransferParams] = map[string]any{
+func (c *nixlV2Connector) PreparePrefill(_ context.Context, _ *http.Request, completionRequest *CompletionRequest) error {
+	if err := completionRequest.Set(requestFieldKVTransferParams, map[string]any{
 		requestFieldDoRemoteDecode:  true,
 		requestFieldDoRemotePrefill: false,
 		requestFieldRemoteEngineID:  nil,
 		requestFieldRemoteBlockIDs:  nil,
 		requestFieldRemoteHost:      nil,
 		requestFieldRemotePort:      nil,
+	}); err != nil {
+		return err
 	}
 
-	completionRequest[requestFieldStream] = false
-	delete(completionRequest, requestFieldStreamOptions)
-	completionRequest[requestFieldMaxTokens] = 1
-
-	pbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+	if err := completionRequest.Set(requestFieldStream, false); err != nil {
+		return err
 	}
-	preq.Body = io.NopCloser(strings.NewReader(string(pbody)))
-	preq.ContentLength = int64(len(pbody))
-
-	prefillHandler, err := s.prefillerProxyHandler(prefillPodHostPort)
-	if err != nil {
-		if err := errorBadGateway(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+	completionRequest.Delete(requestFieldStreamOptions)
+	if err := completionRequest.Set(requestFieldMaxTokens, 1); err != nil {
+		return err
+	}
+	for _, limit := range nixlV2PrefillLimits {
+		if !completionRequest.Has(limit.field) {
+			continue
+		}
+		if err := completionRequest.Set(limit.field, limit.value); err != nil {
+			return err
 		}
-		return
 	}
+	return nil
+}
 
-	// 2. Forward request to prefiller
-	s.logger.V(5).Info("sending request to prefiller", "url", prefillPodHostPort, "body", string(pbody))
-	pw := &bufferedResponseWriter{}
-	prefillHandler.ServeHTTP(pw, preq)
+// InterpretPrefillResponse validates the kv_transfer_params returned by the prefiller. Invalid ones fail the
+// request, fall back to local prefill or are sent as is to the decoder, depending on the connector policy.
+func (c *nixlV2Connector) InterpretPrefillResponse(ctx context.Context, prefillerResponse []byte) (map[string]any, error) {
+	logger := klog.FromContext(ctx)
 
-	if pw.statusCode < 200 || pw.statusCode >= 300 {
-		s.logger.Error(err, "request failed", "code", pw.statusCode)
-		w.WriteHeader(pw.statusCode)
-		return
+	var response struct {
+		KVTransferParams json.RawMessage `json:"kv_transfer_params"`
+	}
+	if err := json.Unmarshal(prefillerResponse, &response); err != nil {
+		return nil, err
 	}
 
-	// Process response - extract p/d fields
-	var prefillerResponse map[string]any
-	if err := json.Unmarshal([]byte(pw.buffer.String()), &prefillerResponse); err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
+	if _, err := parseNIXLV2KVTransferParams(response.KVTransferParams); err != nil {
+		var paramsErr *kvTransferParamsError
+		if errors.As(err, &paramsErr) {
+			kvTransferParamsInvalid.WithLabelValues(paramsErr.reason, c.invalidParamsPolicy).Inc()
 		}
-		return
+		if c.invalidParamsPolicy != kvParamsPolicyPassthrough {
+			return nil, &InvalidPrefillResponseError{
+				Param:    requestFieldKVTransferParams,
+				Fallback: c.invalidParamsPolicy == kvParamsPolicyFallback,
+				Err:      err,
+			}
+		}
+		logger.Info("warning: passing invalid kv_transfer_params through to the decoder", "error", err.Error())
 	}
 
-	// 3. Verify response
+	logger.V(5).Info("received prefiller response", requestFieldKVTransferParams, string(response.KVTransferParams))
 
-	pKVTransferParams, ok := prefillerResponse[requestFieldKVTransferParams]
-	if !ok {
-		s.logger.Info("warning: missing 'kv_transfer_params' field in prefiller response")
+	// the parameters are sent byte for byte to the decoder, including the fields unknown to the sidecar
+	var pKVTransferParams any
+	if len(response.KVTransferParams) > 0 && string(response.KVTransferParams) != "null" {
+		pKVTransferParams = response.KVTransferParams
 	}
+	return map[string]any{requestFieldKVTransferParams: pKVTransferParams}, nil
+}
 
-	s.logger.V(5).Info("received prefiller response", requestFieldKVTransferParams, pKVTransferParams)
-
-	// Decode Stage
-
-	// 1. Prepare decode request
-	dreq := r.Clone(ctx)
-
-	dreq.Header.Add(requestHeaderRequestID, uuidStr)
-
-	delete(completionRequest, requestFieldStream)
-	if streamOk {
-		completionRequest[requestFieldStream] = streamValue
-	}
-	if streamOptionsOk {
-		completionRequest[requestFieldStreamOptions] = streamOptionsValue
-	}
-	delete(completionRequest, requestFieldMaxTokens)
-	if maxTokensOk {
-		completionRequest[requestFieldMaxTokens] = maxTokensValue
-	}
-	completionRequest[requestFieldKVTransferParams] = pKVTransferParams
+func (c *nixlV2Connector) PrepareDecode(_ context.Context, _ *http.Request, completionRequest *CompletionRequest, prefillState map[string]any) error {
+	return completionRequest.Set(requestFieldKVTransferParams, prefillState[requestFieldKVTransferParams])
+}
 
-	dbody, err := json.Marshal(completionRequest)
-	if err != nil {
-		if err := errorJSONInvalid(err, w); err != nil {
-			s.logger.Error(err, "failed to send error response to client")
-		}
-		return
+// PrepareAbort sends the kv_transfer_params returned by the prefiller to its abort endpoint,
+// so that it frees the KV blocks reserved for the decoder.
+func (c *nixlV2Connector) PrepareAbort(_ context.Context, areq *http.Request, prefillState map[string]any) (map[string]any, error) {
+	kvTransferParams := prefillState[requestFieldKVTransferParams]
+	if c.abortPath == "" || kvTransferParams == nil {
+		return nil, nil
 	}
-	dreq.Body = io.NopCloser(strings.NewReader(string(dbody)))
-	dreq.ContentLength = int64(len(dbody))
-
-	// 2. Forward to local decoder.
 
-	s.logger.V(5).Info("sending request to decoder", "body", string(dbody))
-	s.decoderProxy.ServeHTTP(w, dreq)
+	areq.URL.Path = c.abortPath
+	areq.URL.RawPath = ""
+	areq.URL.RawQuery = ""
+	return map[string]any{requestFieldKVTransferParams: kvTransferParams}, nil
 }
@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The policies applied to prefiller responses with missing or invalid kv_transfer_params
+const (
+	// kvParamsPolicyReject fails the request with a 502 error
+	kvParamsPolicyReject = "reject"
+	// kvParamsPolicyFallback sends the request to the local decoder, which performs the prefill itself
+	kvParamsPolicyFallback = "fallback"
+	// kvParamsPolicyPassthrough sends the kv_transfer_params as is to the decoder
+	kvParamsPolicyPassthrough = "passthrough"
+)
+
+// The reasons of invalid kv_transfer_params, besides the name of the invalid field
+const (
+	kvParamsReasonMissing   = "missing"
+	kvParamsReasonMalformed = "malformed"
+)
+
+const requestFieldTPSize = "tp_size"
+
+// nixlV2KVTransferParams are the kv_transfer_params returned by a NIXL v2 prefiller, telling the decoder
+// where to read the KV blocks from. Fields are pointers to tell missing fields apart.
+type nixlV2KVTransferParams struct {
+	RemoteEngineID *string `json:"remote_engine_id"`
+	RemoteBlockIDs []int   `json:"remote_block_ids"`
+	RemoteHost     *string `json:"remote_host"`
+	RemotePort     *int    `json:"remote_port"`
+	TPSize         *int    `json:"tp_size"` // not returned by older vLLM versions
+}
+
+// kvTransferParamsError reports missing or invalid kv_transfer_params in a prefiller response
+type kvTransferParamsError struct {
+	reason  string // kvParamsReasonMissing, kvParamsReasonMalformed or the invalid field
+	message string
+}
+
+func (e *kvTransferParamsError) Error() string {
+	return "invalid kv_transfer_params in prefiller response: " + e.message
+}
+
+// parseNIXLV2KVTransferParams validates the raw kv_transfer_params of a prefiller response
+func parseNIXLV2KVTransferParams(raw json.RawMessage) (*nixlV2KVTransferParams, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, &kvTransferParamsError{reason: kvParamsReasonMissing, message: "missing"}
+	}
+
+	var params nixlV2KVTransferParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			// the field path of array elements, e.g. remote_block_ids.0, is reported as the top-level field
+			field, _, _ := strings.Cut(typeErr.Field, ".")
+			return nil, &kvTransferParamsError{reason: field, message: fmt.Sprintf("%s must not be a %s", typeErr.Field, typeErr.Value)}
+		}
+		return nil, &kvTransferParamsError{reason: kvParamsReasonMalformed, message: err.Error()}
+	}
+
+	switch {
+	case params.RemoteEngineID == nil || *params.RemoteEngineID == "":
+		return nil, &kvTransferParamsError{reason: requestFieldRemoteEngineID, message: requestFieldRemoteEngineID + " is required"}
+	case params.RemoteBlockIDs == nil:
+		return nil, &kvTransferParamsError{reason: requestFieldRemoteBlockIDs, message: requestFieldRemoteBlockIDs + " is required"}
+	case params.RemoteHost == nil || *params.RemoteHost == "":
+		return nil, &kvTransferParamsError{reason: requestFieldRemoteHost, message: requestFieldRemoteHost + " is required"}
+	case params.RemotePort == nil || *params.RemotePort < 1 || *params.RemotePort > 65535:
+		return nil, &kvTransferParamsError{reason: requestFieldRemotePort, message: requestFieldRemotePort + " must be a port number"}
+	case params.TPSize != nil && *params.TPSize < 1:
+		return nil, &kvTransferParamsError{reason: requestFieldTPSize, message: requestFieldTPSize + " must be positive"}
+	}
+	for _, id := range params.RemoteBlockIDs {
+		if id < 0 {
+			return nil, &kvTransferParamsError{reason: requestFieldRemoteBlockIDs, message: fmt.Sprintf("invalid block ID %d", id)}
+		}
+	}
+	return &params, nil
+}
@@ -18,16 +18,19 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
-	"time"
 
 	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
 	. "github.com/onsi/ginkgo/v2" // nolint:revive
 	. "github.com/onsi/gomega"    // nolint:revive
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"k8s.io/klog/v2/ktesting"
 )
 
@@ -79,7 +82,7 @@ var _ = Describe("NIXL Connector (v2)", func() {
 			Expect(err).ToNot(HaveOccurred())
 		}()
 
-		time.Sleep(1 * time.Second)
+		waitForProxy(proxy)
 		Expect(proxy.addr).ToNot(BeNil())
 		proxyBaseAddr := "http://" + proxy.addr.String()
 
@@ -141,7 +144,7 @@ var _ = Describe("NIXL Connector (v2)", func() {
 			Expect(err).ToNot(HaveOccurred())
 		}()
 
-		time.Sleep(1 * time.Second)
+		waitForProxy(proxy)
 		Expect(proxy.addr).ToNot(BeNil())
 		proxyBaseAddr := "http://" + proxy.addr.String()
 
@@ -194,3 +197,190 @@ var _ = Describe("NIXL Connector (v2)", func() {
 		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
 	})
 })
+
+var _ = Describe("NIXL v2 prefill limits", func() {
+	const (
+		completionsBody     = `{"model": "m", "prompt": "Hello", "max_tokens": 50, %s}`
+		chatCompletionsBody = `{"model": "m", "messages": [{"role": "user", "content": "Hello"}], %s}`
+	)
+
+	// rewrite returns the prefill and decode requests built from the client request
+	rewrite := func(body string) (map[string]any, map[string]any) {
+		ctx := context.Background()
+		connector, err := NewConnector(ConnectorNIXLV2, nil)
+		Expect(err).ToNot(HaveOccurred())
+		req := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+
+		prefillRequest, err := ParseCompletionRequest([]byte(body))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connector.PreparePrefill(ctx, req, prefillRequest)).To(Succeed())
+
+		decodeRequest, err := ParseCompletionRequest([]byte(body))
+		Expect(err).ToNot(HaveOccurred())
+		prefillState := map[string]any{requestFieldKVTransferParams: json.RawMessage(`{"remote_engine_id":"e"}`)}
+		Expect(connector.PrepareDecode(ctx, req, decodeRequest, prefillState)).To(Succeed())
+
+		var prefill, decode map[string]any
+		Expect(json.Unmarshal(prefillRequest.Bytes(), &prefill)).To(Succeed())
+		Expect(json.Unmarshal(decodeRequest.Bytes(), &decode)).To(Succeed())
+		return prefill, decode
+	}
+
+	DescribeTable("should limit the prefill to a single token and sample, and keep the client values for decode",
+		func(template string, field string, value string, prefillValue any) {
+			prefill, decode := rewrite(fmt.Sprintf(template, `"`+field+`": `+value))
+			Expect(prefill).To(HaveKeyWithValue(field, prefillValue))
+			Expect(prefill).To(HaveKeyWithValue(requestFieldMaxTokens, BeNumerically("==", 1)))
+
+			Expect(decode).To(HaveKey(field))
+			Expect(json.Marshal(decode[field])).To(MatchJSON(value))
+		},
+		Entry("completions, max_tokens", completionsBody, requestFieldMaxTokens, "100", BeNumerically("==", 1)),
+		Entry("completions, max_completion_tokens", completionsBody, requestFieldMaxCompletionTokens, "100", BeNumerically("==", 1)),
+		Entry("completions, min_tokens", completionsBody, requestFieldMinTokens, "10", BeNumerically("==", 0)),
+		Entry("completions, n", completionsBody, requestFieldN, "4", BeNumerically("==", 1)),
+		Entry("completions, best_of", completionsBody, requestFieldBestOf, "5", BeNumerically("==", 1)),
+		Entry("chat completions, max_tokens", chatCompletionsBody, requestFieldMaxTokens, "100", BeNumerically("==", 1)),
+		Entry("chat completions, max_completion_tokens", chatCompletionsBody, requestFieldMaxCompletionTokens, "100", BeNumerically("==", 1)),
+		Entry("chat completions, null max_completion_tokens", chatCompletionsBody, requestFieldMaxCompletionTokens, "null", BeNumerically("==", 1)),
+		Entry("chat completions, min_tokens", chatCompletionsBody, requestFieldMinTokens, "10", BeNumerically("==", 0)),
+		Entry("chat completions, n", chatCompletionsBody, requestFieldN, "4", BeNumerically("==", 1)),
+		Entry("chat completions, best_of", chatCompletionsBody, requestFieldBestOf, "5", BeNumerically("==", 1)),
+	)
+
+	DescribeTable("should not add the limits unset by the client",
+		func(template string) {
+			prefill, decode := rewrite(fmt.Sprintf(template, `"temperature": 0`))
+			for _, field := range []string{requestFieldMaxCompletionTokens, requestFieldMinTokens, requestFieldN, requestFieldBestOf} {
+				Expect(prefill).ToNot(HaveKey(field))
+				Expect(decode).ToNot(HaveKey(field))
+			}
+			Expect(prefill).To(HaveKeyWithValue(requestFieldMaxTokens, BeNumerically("==", 1)))
+		},
+		Entry("completions", completionsBody),
+		Entry("chat completions", chatCompletionsBody),
+	)
+})
+
+var _ = Describe("NIXL v2 kv_transfer_params validation", func() {
+	const validParams = `{"remote_engine_id":"e","remote_block_ids":[1,2],"remote_host":"10.0.0.1","remote_port":5600,"tp_size":1}`
+
+	DescribeTable("should validate the kv_transfer_params",
+		func(raw string, reason string) {
+			params, err := parseNIXLV2KVTransferParams(json.RawMessage(raw))
+			if reason == "" {
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params).ToNot(BeNil())
+				return
+			}
+			var paramsErr *kvTransferParamsError
+			Expect(errors.As(err, &paramsErr)).To(BeTrue())
+			Expect(paramsErr.reason).To(Equal(reason))
+		},
+		Entry("valid", validParams, ""),
+		Entry("without tp_size", `{"remote_engine_id":"e","remote_block_ids":[],"remote_host":"h","remote_port":1}`, ""),
+		Entry("missing", ``, kvParamsReasonMissing),
+		Entry("null", `null`, kvParamsReasonMissing),
+		Entry("not an object", `[1]`, kvParamsReasonMalformed),
+		Entry("missing engine ID", `{"remote_block_ids":[1],"remote_host":"h","remote_port":1}`, requestFieldRemoteEngineID),
+		Entry("null block IDs", `{"remote_engine_id":"e","remote_block_ids":null,"remote_host":"h","remote_port":1}`, requestFieldRemoteBlockIDs),
+		Entry("string block IDs", `{"remote_engine_id":"e","remote_block_ids":["1"],"remote_host":"h","remote_port":1}`, requestFieldRemoteBlockIDs),
+		Entry("negative block ID", `{"remote_engine_id":"e","remote_block_ids":[-1],"remote_host":"h","remote_port":1}`, requestFieldRemoteBlockIDs),
+		Entry("empty host", `{"remote_engine_id":"e","remote_block_ids":[1],"remote_host":"","remote_port":1}`, requestFieldRemoteHost),
+		Entry("invalid port", `{"remote_engine_id":"e","remote_block_ids":[1],"remote_host":"h","remote_port":70000}`, requestFieldRemotePort),
+		Entry("string port", `{"remote_engine_id":"e","remote_block_ids":[1],"remote_host":"h","remote_port":"1"}`, requestFieldRemotePort),
+		Entry("invalid TP size", `{"remote_engine_id":"e","remote_block_ids":[1],"remote_host":"h","remote_port":1,"tp_size":0}`, requestFieldTPSize),
+	)
+
+	It("should reject an invalid policy", func() {
+		_, err := NewConnector(ConnectorNIXLV2, map[string]string{nixlV2OptionInvalidParamsPolicy: "ignore"})
+		Expect(err).To(MatchError(ContainSubstring(nixlV2OptionInvalidParamsPolicy)))
+	})
+
+	Context("with a prefiller returning invalid kv_transfer_params", func() {
+		var decodeHandler *mock.ChatCompletionHandler
+
+		// send starts a proxy with the given policy and sends a request prefilled by a prefiller without kv_transfer_params
+		send := func(policy string) *http.Response {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+			decodeBackend := httptest.NewServer(decodeHandler)
+			DeferCleanup(decodeBackend.Close)
+			prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte(`{"choices":[{"text":"a"}],"kv_transfer_params":{"remote_engine_id":"e","remote_block_ids":[1],"x":1}}`)) //nolint:all
+			}))
+			DeferCleanup(prefillBackend.Close)
+
+			decodeURL, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			proxy, err := NewProxy("0", decodeURL, Config{
+				Connector:        ConnectorNIXLV2,
+				ConnectorOptions: map[string]string{nixlV2OptionInvalidParamsPolicy: policy},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			waitForProxy(proxy)
+
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath,
+				strings.NewReader(`{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(resp.Body.Close)
+			return resp
+		}
+
+		invalid := func(policy string) float64 {
+			return testutil.ToFloat64(kvTransferParamsInvalid.WithLabelValues(requestFieldRemoteHost, policy))
+		}
+
+		It("should fail the request with a structured error", func() {
+			before := invalid(kvParamsPolicyReject)
+			resp := send(kvParamsPolicyReject)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadGateway))
+
+			var body errorResponse
+			Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+			Expect(body.Object).To(Equal("error"))
+			Expect(body.Param).To(HaveValue(Equal(requestFieldKVTransferParams)))
+			Expect(body.Message).To(ContainSubstring(requestFieldRemoteHost))
+			Expect(body.Code).To(Equal(http.StatusBadGateway))
+
+			Expect(decodeHandler.RequestCount.Load()).To(BeZero())
+			Expect(invalid(kvParamsPolicyReject)).To(Equal(before + 1))
+		})
+
+		DescribeTable("should fall back to local prefill",
+			func(policy string) {
+				before := invalid(kvParamsPolicyFallback)
+				resp := send(policy)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Header.Get(responseHeaderPrefillFallback)).To(Equal(fallbackReasonInvalidResponse))
+
+				Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+				Expect(decodeHandler.CompletionRequests[0]).ToNot(HaveKey(requestFieldKVTransferParams))
+				Expect(invalid(kvParamsPolicyFallback)).To(Equal(before + 1))
+			},
+			Entry("by default", ""),
+			Entry("when configured", kvParamsPolicyFallback),
+		)
+
+		It("should pass the kv_transfer_params through when configured", func() {
+			before := invalid(kvParamsPolicyPassthrough)
+			resp := send(kvParamsPolicyPassthrough)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+			Expect(decodeHandler.CompletionRequests[0]).To(HaveKeyWithValue(requestFieldKVTransferParams,
+				HaveKeyWithValue("x", BeNumerically("==", 1))))
+			Expect(invalid(kvParamsPolicyPassthrough)).To(Equal(before + 1))
+		})
+	})
+})
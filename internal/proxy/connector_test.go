@@ -0,0 +1,155 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// testConnector is an in-house connector used to verify the registry
+type testConnector struct {
+	marker string
+}
+
+func (c *testConnector) PreparePrefill(_ context.Context, preq *http.Request, completionRequest *CompletionRequest) error {
+	preq.Header.Set("x-test-stage", "prefill")
+	return completionRequest.Set("test_marker", c.marker)
+}
+
+func (c *testConnector) InterpretPrefillResponse(_ context.Context, prefillerResponse []byte) (map[string]any, error) {
+	var response map[string]any
+	if err := json.Unmarshal(prefillerResponse, &response); err != nil {
+		return nil, err
+	}
+	return map[string]any{"test_state": "from-prefill"}, nil
+}
+
+func (c *testConnector) PrepareDecode(_ context.Context, _ *http.Request, completionRequest *CompletionRequest, prefillState map[string]any) error {
+	return completionRequest.Set("test_state", prefillState["test_state"])
+}
+
+const testConnectorName = "test-connector"
+
+func init() {
+	RegisterConnector(testConnectorName, ConnectorRegistration{
+		Description: "connector used by tests",
+		Options:     map[string]string{"marker": "value added to prefill requests"},
+		Factory: func(options map[string]string) (Connector, error) {
+			marker, ok := options["marker"]
+			if !ok {
+				return nil, errors.New("missing marker option")
+			}
+			return &testConnector{marker: marker}, nil
+		},
+	})
+}
+
+var _ = Describe("Connector registry", func() {
+	It("should list the built-in connectors", func() {
+		Expect(RegisteredConnectors()).To(ContainElements(ConnectorNIXLV1, ConnectorNIXLV2, ConnectorLMCache))
+
+		registration, ok := LookupConnector(ConnectorNIXLV1)
+		Expect(ok).To(BeTrue())
+		Expect(registration.Deprecated).To(BeTrue())
+	})
+
+	It("should reject unknown connectors and invalid options", func() {
+		_, err := NewConnector("unknown", nil)
+		Expect(err).To(HaveOccurred())
+
+		_, err = NewConnector(testConnectorName, nil)
+		Expect(err).To(MatchError(ContainSubstring("missing marker option")))
+
+		_, err = NewConnector(testConnectorName, map[string]string{"marker": "m", "other": "o"})
+		Expect(err).To(MatchError(ContainSubstring(`does not support option "other"`)))
+
+		_, err = NewProxy("0", &url.URL{}, Config{Connector: "unknown"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should panic when registering a connector twice", func() {
+		Expect(func() {
+			RegisterConnector(ConnectorNIXLV2, ConnectorRegistration{
+				Factory: func(map[string]string) (Connector, error) { return &nixlV2Connector{}, nil },
+			})
+		}).To(Panic())
+	})
+
+	It("should run the hooks of a registered connector", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV1, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		var prefillStage string
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV1, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prefillStage = r.Header.Get("x-test-stage")
+			prefillHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		cfg := Config{Connector: testConnectorName, ConnectorOptions: map[string]string{"marker": "abc"}}
+		proxy, err := NewProxy("0", decodeURL, cfg) // port 0 to automatically choose one that's available.
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(prefillStage).To(Equal("prefill"))
+		Expect(prefillHandler.CompletionRequests).To(HaveLen(1))
+		Expect(prefillHandler.CompletionRequests[0]).To(HaveKeyWithValue("test_marker", "abc"))
+
+		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+		Expect(decodeHandler.CompletionRequests[0]).ToNot(HaveKey("test_marker"))
+		Expect(decodeHandler.CompletionRequests[0]).To(HaveKeyWithValue("test_state", "from-prefill"))
+	})
+})
@@ -17,62 +17,154 @@ limitations under the License.
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
-// vLLM error response
-type errorResponse struct {
-	Object  string `json:"object"`
-	Message string `json:"message"`
-	Type    string `json:"type"`
-	Param   string `json:"param"`
-	Code    int    `json:"code"`
-}
+// responseHeaderErrorCode is the header of the error responses telling which stage of the request failed
+const responseHeaderErrorCode = "x-sidecar-error-code"
 
-func errorJSONInvalid(err error, w http.ResponseWriter) error {
-	// Simulate vLLM error
+// sidecar error codes, prefixed by the failed stage
+const (
+	errorCodeRequestInvalid           = "request_invalid"
+	errorCodeRequestTooLarge          = "request_too_large"
+	errorCodeRequestDeadlineExceeded  = "request_deadline_exceeded"
+	errorCodeRequestSSRFRejected      = "request_ssrf_rejected"
+	errorCodeRequestClientCertificate = "request_client_certificate"
+	errorCodeRequestInternal          = "request_internal_error"
+	errorCodePrefillError             = "prefill_error"
+	errorCodePrefillUnavailable       = "prefill_unavailable"
+	errorCodePrefillTimeout           = "prefill_timeout"
+	errorCodePrefillInvalidResponse   = "prefill_invalid_response"
+	errorCodeDecodeUnavailable        = "decode_unavailable"
+	errorCodeDecodeTimeout            = "decode_timeout"
+	errorCodeDecodeFirstTokenMismatch = "decode_first_token_mismatch"
+)
 
-	// Example:
-	//{
-	//	"object": "error",
-	//	"message": "[{'type': 'json_invalid', 'loc': ('body', 167), 'msg': 'JSON decode error', 'input': {}, 'ctx': {'error': 'Invalid control character at'}}]",
-	//	"type": "BadRequestError",
-	//	"param": null,
-	//	"code": 400
-	//  }
+// maxErrorBodyLength bounds the prefiller response body quoted in error messages
+const maxErrorBodyLength = 512
 
-	er := errorResponse{
-		Object:  "error",
-		Message: err.Error(),
-		Type:    "BadRequestError",
-		Code:    http.StatusBadRequest,
-	}
+// vLLM error response
+type errorResponse struct {
+	Object  string  `json:"object"`
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    int     `json:"code"`
+}
 
-	b, err := json.Marshal(er)
+// writeError sends an error response in the vLLM format, e.g.
+//
+//	{
+//		"object": "error",
+//		"message": "[{'type': 'json_invalid', 'loc': ('body', 167), 'msg': 'JSON decode error', 'input': {}, 'ctx': {'error': 'Invalid control character at'}}]",
+//		"type": "BadRequestError",
+//		"param": null,
+//		"code": 400
+//	}
+//
+// code is the sidecar error code, which prefixes the message, and param the invalid request or response field,
+// if known.
+func writeError(w http.ResponseWriter, statusCode int, code string, param string, err error) error {
+	b, err := errorBody(statusCode, code, param, err)
 	if err != nil {
 		return err
 	}
 
-	w.WriteHeader(http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(responseHeaderErrorCode, code)
+	w.WriteHeader(statusCode)
 	_, err = w.Write(b)
 	return err
 }
 
-func errorBadGateway(err error, w http.ResponseWriter) error {
+// errorBody returns the body of a vLLM error response, see writeError
+func errorBody(statusCode int, code string, param string, err error) ([]byte, error) {
 	er := errorResponse{
 		Object:  "error",
-		Message: err.Error(),
-		Type:    "BadGateway",
-		Code:    http.StatusBadGateway,
+		Message: code + ": " + err.Error(),
+		Type:    errorType(statusCode),
+		Code:    statusCode,
+	}
+	if param != "" {
+		er.Param = &param
 	}
 
-	b, err := json.Marshal(er)
-	if err != nil {
+	return json.Marshal(er)
+}
+
+// errorType returns the error type of the status code: the OpenAI client error names for the common client
+// errors, e.g. BadRequestError, and the status text otherwise, e.g. BadGateway
+func errorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "BadRequestError"
+	case http.StatusUnauthorized:
+		return "AuthenticationError"
+	case http.StatusForbidden:
+		return "PermissionDeniedError"
+	case http.StatusNotFound:
+		return "NotFoundError"
+	case http.StatusUnprocessableEntity:
+		return "UnprocessableEntityError"
+	case http.StatusTooManyRequests:
+		return "RateLimitError"
+	}
+	if text := http.StatusText(statusCode); text != "" {
+		return strings.ReplaceAll(text, " ", "")
+	}
+	return "InternalServerError"
+}
+
+// writePrefillError sends the error returned by the prefiller: its body is passed through when it is a JSON
+// object, such as a vLLM error, and is wrapped in a vLLM error otherwise
+func writePrefillError(w http.ResponseWriter, pw *bufferedResponseWriter) error {
+	body := bytes.TrimSpace(pw.Bytes())
+	if len(body) > 0 && body[0] == '{' && json.Valid(body) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(responseHeaderErrorCode, errorCodePrefillError)
+		w.WriteHeader(pw.statusCode)
+		_, err := w.Write(prefixErrorMessage(body, errorCodePrefillError))
 		return err
 	}
 
-	w.WriteHeader(http.StatusBadGateway)
-	_, err = w.Write(b)
-	return err
+	message := fmt.Sprintf("prefill failed with status %d", pw.statusCode)
+	if len(body) > maxErrorBodyLength {
+		body = append(body[:maxErrorBodyLength:maxErrorBodyLength], "..."...)
+	}
+	if len(body) > 0 {
+		message += ": " + string(body)
+	}
+	return writeError(w, pw.statusCode, errorCodePrefillError, "", errors.New(message))
+}
+
+// prefixErrorMessage prefixes the message of a vLLM or OpenAI JSON error with the sidecar error code, keeping the
+// other fields byte for byte. Other JSON objects are returned as is.
+func prefixErrorMessage(body []byte, code string) []byte {
+	response, err := ParseCompletionRequest(body)
+	if err != nil {
+		return body
+	}
+
+	// OpenAI format: {"error": {"message": ...}}
+	var nested json.RawMessage
+	if ok, _ := response.Get("error", &nested); ok {
+		if err := response.Set("error", json.RawMessage(prefixErrorMessage(nested, code))); err != nil {
+			return body
+		}
+		return response.Bytes()
+	}
+
+	var message string
+	if ok, err := response.Get("message", &message); !ok || err != nil {
+		return body
+	}
+	if err := response.Set("message", code+": "+message); err != nil {
+		return body
+	}
+	return response.Bytes()
 }
@@ -0,0 +1,195 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Error responses", func() {
+	DescribeTable("should name the error types",
+		func(statusCode int, expected string) {
+			Expect(errorType(statusCode)).To(Equal(expected))
+		},
+		Entry("bad request", http.StatusBadRequest, "BadRequestError"),
+		Entry("unauthorized", http.StatusUnauthorized, "AuthenticationError"),
+		Entry("forbidden", http.StatusForbidden, "PermissionDeniedError"),
+		Entry("too large", http.StatusRequestEntityTooLarge, "RequestEntityTooLarge"),
+		Entry("internal", http.StatusInternalServerError, "InternalServerError"),
+		Entry("bad gateway", http.StatusBadGateway, "BadGateway"),
+		Entry("gateway timeout", http.StatusGatewayTimeout, "GatewayTimeout"),
+		Entry("unknown", 599, "InternalServerError"),
+	)
+
+	It("should write the errors in the vLLM format", func() {
+		w := httptest.NewRecorder()
+		Expect(writeError(w, http.StatusBadGateway, errorCodePrefillInvalidResponse, requestFieldKVTransferParams, errors.New("invalid"))).To(Succeed())
+		Expect(w.Code).To(Equal(http.StatusBadGateway))
+		Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(w.Header().Get(responseHeaderErrorCode)).To(Equal(errorCodePrefillInvalidResponse))
+		Expect(w.Body.String()).To(MatchJSON(`{"object":"error","message":"prefill_invalid_response: invalid","type":"BadGateway","param":"kv_transfer_params","code":502}`))
+	})
+
+	DescribeTable("should pass the prefiller JSON errors through",
+		func(statusCode int, body string, expected string) {
+			pw := &bufferedResponseWriter{}
+			pw.WriteHeader(statusCode)
+			pw.Write([]byte(body)) //nolint:all
+			DeferCleanup(pw.release)
+
+			w := httptest.NewRecorder()
+			Expect(writePrefillError(w, pw)).To(Succeed())
+			Expect(w.Code).To(Equal(statusCode))
+			Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(w.Header().Get(responseHeaderErrorCode)).To(Equal(errorCodePrefillError))
+			Expect(w.Body.String()).To(MatchJSON(expected))
+		},
+		Entry("vLLM error", http.StatusBadRequest,
+			`{"object":"error","message":"max_tokens is too large","type":"BadRequestError","param":null,"code":400}`,
+			`{"object":"error","message":"prefill_error: max_tokens is too large","type":"BadRequestError","param":null,"code":400}`),
+		Entry("OpenAI error", http.StatusNotFound,
+			`{"error":{"message":"model not found","type":"NotFoundError","param":null,"code":404}}`,
+			`{"error":{"message":"prefill_error: model not found","type":"NotFoundError","param":null,"code":404}}`),
+		Entry("other JSON object", http.StatusBadGateway, `{"detail":"upstream failed"}`, `{"detail":"upstream failed"}`),
+		Entry("plain text", http.StatusServiceUnavailable, "overloaded\n",
+			`{"object":"error","message":"prefill_error: prefill failed with status 503: overloaded","type":"ServiceUnavailable","param":null,"code":503}`),
+		Entry("empty", http.StatusInternalServerError, "",
+			`{"object":"error","message":"prefill_error: prefill failed with status 500","type":"InternalServerError","param":null,"code":500}`),
+	)
+
+	Context("when a stage fails", func() {
+		var (
+			ctx       context.Context
+			decodeURL *url.URL
+		)
+
+		BeforeEach(func() {
+			_, ctx = ktesting.NewTestContext(GinkgoT())
+			var cancelFn context.CancelFunc
+			ctx, cancelFn = context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+			DeferCleanup(decodeBackend.Close)
+			var err error
+			decodeURL, err = url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		startProxy := func(decodeURL *url.URL) string {
+			proxy, err := NewProxy("0", decodeURL, Config{}) // port 0 to automatically choose one that's available.
+			Expect(err).ToNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+
+				err := proxy.Start(ctx)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+
+			waitForProxy(proxy)
+			Expect(proxy.addr).ToNot(BeNil())
+			return "http://" + proxy.addr.String()
+		}
+
+		// sendRequest returns the response status code, sidecar error code and body
+		sendRequest := func(proxyBaseAddr string, prefillHostPort string) (int, string, string) {
+			body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+			req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			if prefillHostPort != "" {
+				req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+			}
+
+			rp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			b, err := io.ReadAll(rp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rp.Body.Close()).To(Succeed())
+			return rp.StatusCode, rp.Header.Get(responseHeaderErrorCode), string(b)
+		}
+
+		prefiller := func(statusCode int, body string) string {
+			prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(statusCode)
+				w.Write([]byte(body)) //nolint:all
+			}))
+			DeferCleanup(prefillBackend.Close)
+			return prefillBackend.URL[len("http://"):]
+		}
+
+		It("should pass the prefiller JSON error through", func() {
+			prefillError := `{"object":"error","message":"This model's maximum context length is 2048 tokens","type":"BadRequestError","param":null,"code":400}`
+			status, code, body := sendRequest(startProxy(decodeURL), prefiller(http.StatusBadRequest, prefillError))
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(code).To(Equal(errorCodePrefillError))
+			Expect(body).To(MatchJSON(`{"object":"error","message":"prefill_error: This model's maximum context length is 2048 tokens","type":"BadRequestError","param":null,"code":400}`))
+		})
+
+		It("should wrap the prefiller plain text error", func() {
+			status, code, body := sendRequest(startProxy(decodeURL), prefiller(http.StatusInternalServerError, "Internal Server Error"))
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			Expect(code).To(Equal(errorCodePrefillError))
+			var er errorResponse
+			Expect(json.Unmarshal([]byte(body), &er)).To(Succeed())
+			Expect(er.Object).To(Equal("error"))
+			Expect(er.Message).To(Equal("prefill_error: prefill failed with status 500: Internal Server Error"))
+			Expect(er.Code).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("should report an unreachable prefiller", func() {
+			prefillBackend := httptest.NewServer(http.NotFoundHandler())
+			prefillHostPort := prefillBackend.URL[len("http://"):]
+			prefillBackend.Close()
+
+			status, code, body := sendRequest(startProxy(decodeURL), prefillHostPort)
+			Expect(status).To(Equal(http.StatusBadGateway))
+			Expect(code).To(Equal(errorCodePrefillUnavailable))
+			var er errorResponse
+			Expect(json.Unmarshal([]byte(body), &er)).To(Succeed())
+			Expect(er.Type).To(Equal("BadGateway"))
+			Expect(er.Message).To(HavePrefix("prefill_unavailable: prefill failed: "))
+		})
+
+		It("should report an unreachable decoder", func() {
+			decodeBackend := httptest.NewServer(http.NotFoundHandler())
+			unreachable, err := url.Parse(decodeBackend.URL)
+			Expect(err).ToNot(HaveOccurred())
+			decodeBackend.Close()
+
+			status, code, body := sendRequest(startProxy(unreachable), "")
+			Expect(status).To(Equal(http.StatusBadGateway))
+			Expect(code).To(Equal(errorCodeDecodeUnavailable))
+			var er errorResponse
+			Expect(json.Unmarshal([]byte(body), &er)).To(Succeed())
+			Expect(er.Type).To(Equal("BadGateway"))
+			Expect(er.Message).To(HavePrefix("decode_unavailable: decode failed: "))
+		})
+	})
+})
@@ -0,0 +1,147 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+	"k8s.io/utils/set"
+)
+
+var _ = Describe("Prefiller failover", func() {
+	var (
+		proxy         *Server
+		proxyBaseAddr string
+		decodeHandler *mock.ChatCompletionHandler
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = NewProxy("0", decodeURL, Config{})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		proxyBaseAddr = "http://" + proxy.addr.String()
+	})
+
+	prefiller := func(statusCode int) (string, *mock.ChatCompletionHandler) {
+		handler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if statusCode != http.StatusOK {
+				handler.RequestCount.Add(1)
+				w.WriteHeader(statusCode)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(backend.Close)
+		return backend.URL[len("http://"):], handler
+	}
+
+	refusingPrefiller := func() string {
+		backend := httptest.NewServer(http.NotFoundHandler())
+		backend.Close()
+		return backend.URL[len("http://"):]
+	}
+
+	send := func(header http.Header) *http.Response {
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+		return rp
+	}
+
+	It("should try the candidates in order until one succeeds", func() {
+		unavailable, unavailableHandler := prefiller(http.StatusServiceUnavailable)
+		healthy, healthyHandler := prefiller(http.StatusOK)
+
+		rp := send(http.Header{
+			requestHeaderPrefillHostPort:   {refusingPrefiller() + "," + unavailable},
+			requestHeaderPrefillAlternates: {healthy},
+		})
+
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillAttempts)).To(Equal("3"))
+		Expect(rp.Header.Get(responseHeaderPrefillHostPort)).To(Equal(healthy))
+		Expect(unavailableHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(healthyHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should not retry client errors", func() {
+		invalid, _ := prefiller(http.StatusBadRequest)
+		healthy, healthyHandler := prefiller(http.StatusOK)
+
+		rp := send(http.Header{requestHeaderPrefillHostPort: {invalid + ", " + healthy}})
+
+		Expect(rp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(rp.Header.Get(responseHeaderPrefillAttempts)).To(Equal("1"))
+		Expect(healthyHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+
+	It("should skip candidates not in the allowlist", func() {
+		healthy, healthyHandler := prefiller(http.StatusOK)
+		_, port, _ := strings.Cut(healthy, ":")
+
+		proxy.allowlistValidator = &AllowlistValidator{
+			enabled:        true,
+			allowedTargets: map[string]set.Set[string]{"127.0.0.1": set.New(port)},
+			stopCh:         make(chan struct{}),
+		}
+
+		rp := send(http.Header{requestHeaderPrefillHostPort: {"localhost:" + port + "," + healthy}})
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillAttempts)).To(Equal("1"))
+		Expect(healthyHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+
+		rp = send(http.Header{requestHeaderPrefillHostPort: {"localhost:" + port}})
+		Expect(rp.StatusCode).To(Equal(http.StatusForbidden))
+	})
+})
@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// responseHeaderPrefillFallback is set on client responses served by a local prefill fallback.
+	// Its value is the reason of the fallback.
+	responseHeaderPrefillFallback = "x-prefill-fallback"
+
+	fallbackReasonConnectionRefused = "connection-refused"
+	fallbackReasonTimeout           = "timeout"
+	fallbackReasonError             = "error"
+	fallbackReasonInvalidResponse   = "invalid-response"
+	fallbackReasonStatusPrefix      = "status-"
+)
+
+// FallbackPolicy configures the fallback to local (aggregated) prefill on the decoder
+// when the remote prefill fails.
+type FallbackPolicy struct {
+	// Enabled enables the fallback. When the prefiller is unreachable, times out, returns
+	// an invalid response or one of StatusCodes, the original request is sent to the local
+	// decoder without kv_transfer_params.
+	Enabled bool
+
+	// StatusCodes lists the prefiller status codes triggering a fallback. Entries are either
+	// a status code (e.g. "503") or a status class (e.g. "5xx"). Defaults to "5xx".
+	StatusCodes []string
+}
+
+// Validate checks the status codes are well-formed
+func (p FallbackPolicy) Validate() error {
+	for _, code := range p.StatusCodes {
+		if _, _, err := parseStatusCodePattern(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchStatus returns true when the given prefiller status code triggers a fallback
+func (p FallbackPolicy) matchStatus(statusCode int) bool {
+	patterns := p.StatusCodes
+	if len(patterns) == 0 {
+		patterns = []string{"5xx"}
+	}
+	for _, pattern := range patterns {
+		low, high, err := parseStatusCodePattern(pattern)
+		if err == nil && statusCode >= low && statusCode <= high {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusCodePattern returns the inclusive range of status codes matched by pattern
+func parseStatusCodePattern(pattern string) (int, int, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if len(pattern) == 3 && strings.HasSuffix(pattern, "xx") && pattern[0] >= '1' && pattern[0] <= '5' {
+		low := int(pattern[0]-'0') * 100
+		return low, low + 99, nil
+	}
+	code, err := strconv.Atoi(pattern)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid status code %q: expected a status code (e.g. 503) or a status class (e.g. 5xx)", pattern)
+	}
+	return code, code, nil
+}
+
+// prefillFailureReason returns the reason of a failed prefill request
+func prefillFailureReason(pw *bufferedResponseWriter) string {
+	switch {
+	case pw.err == nil:
+		return fallbackReasonStatusPrefix + strconv.Itoa(pw.statusCode)
+	case errors.Is(pw.err, syscall.ECONNREFUSED):
+		return fallbackReasonConnectionRefused
+	case isTimeout(pw.err):
+		return fallbackReasonTimeout
+	default:
+		return fallbackReasonError
+	}
+}
+
+// isTimeout returns true when err is caused by a deadline or a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// shouldFallback returns true when the failed prefill must fall back to local prefill
+func (s *Server) shouldFallback(r *http.Request, pw *bufferedResponseWriter) bool {
+	policy := s.currentConfig().PrefillFallback
+	if !policy.Enabled || r.Context().Err() != nil {
+		return false
+	}
+	if pw.err != nil {
+		return true
+	}
+	return policy.matchStatus(pw.statusCode)
+}
+
+// runLocalPrefill sends the original request, without kv_transfer_params, to the local decoder
+func (s *Server) runLocalPrefill(w http.ResponseWriter, r *http.Request, original *requestBody, reason string) {
+	logger := klog.FromContext(r.Context())
+	logger.Info("falling back to local prefill", "fallback", true, "reason", reason)
+
+	completionRequest, err := ParseCompletionRequest(original.Bytes())
+	if err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return
+	}
+	completionRequest.Delete(requestFieldKVTransferParams)
+	body := completionRequest.requestBody(original)
+	defer body.release()
+
+	dreq := r.Clone(r.Context())
+	dreq.Body = body.reader()
+	dreq.ContentLength = body.Len()
+
+	w.Header().Set(responseHeaderPrefillFallback, reason)
+	s.serveDecode(w, dreq)
+}
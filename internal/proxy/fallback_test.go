@@ -0,0 +1,143 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Prefill fallback", func() {
+	var (
+		ctx           context.Context
+		decodeHandler *mock.ChatCompletionHandler
+		decodeURL     *url.URL
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RoleDecode,
+		}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	startProxy := func(cfg Config) string {
+		proxy, err := NewProxy("0", decodeURL, cfg) // port 0 to automatically choose one that's available.
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		return "http://" + proxy.addr.String()
+	}
+
+	sendRequest := func(proxyBaseAddr string, prefillHostPort string) *http.Response {
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50, "kv_transfer_params": {"do_remote_decode": true}}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+		return rp
+	}
+
+	failingPrefiller := func(statusCode int) string {
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(statusCode)
+		}))
+		DeferCleanup(prefillBackend.Close)
+		return prefillBackend.URL[len("http://"):]
+	}
+
+	It("should send the request to the decoder without kv_transfer_params when the prefiller returns 5xx", func() {
+		proxyBaseAddr := startProxy(Config{PrefillFallback: FallbackPolicy{Enabled: true}})
+
+		rp := sendRequest(proxyBaseAddr, failingPrefiller(http.StatusServiceUnavailable))
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillFallback)).To(Equal("status-503"))
+
+		Expect(decodeHandler.CompletionRequests).To(HaveLen(1))
+		Expect(decodeHandler.CompletionRequests[0]).ToNot(HaveKey(requestFieldKVTransferParams))
+		Expect(decodeHandler.CompletionRequests[0]).To(HaveKeyWithValue(requestFieldMaxTokens, BeNumerically("==", 50)))
+	})
+
+	It("should fall back when the prefiller refuses the connection", func() {
+		proxyBaseAddr := startProxy(Config{PrefillFallback: FallbackPolicy{Enabled: true}})
+
+		prefillBackend := httptest.NewServer(http.NotFoundHandler())
+		prefillHostPort := prefillBackend.URL[len("http://"):]
+		prefillBackend.Close()
+
+		rp := sendRequest(proxyBaseAddr, prefillHostPort)
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillFallback)).To(Equal(fallbackReasonConnectionRefused))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should follow the per-status-code policy", func() {
+		proxyBaseAddr := startProxy(Config{PrefillFallback: FallbackPolicy{Enabled: true, StatusCodes: []string{"429"}}})
+
+		rp := sendRequest(proxyBaseAddr, failingPrefiller(http.StatusServiceUnavailable))
+		Expect(rp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(rp.Header.Get(responseHeaderPrefillFallback)).To(BeEmpty())
+
+		rp = sendRequest(proxyBaseAddr, failingPrefiller(http.StatusTooManyRequests))
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillFallback)).To(Equal("status-429"))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("should not fall back when disabled", func() {
+		proxyBaseAddr := startProxy(Config{})
+
+		rp := sendRequest(proxyBaseAddr, failingPrefiller(http.StatusServiceUnavailable))
+		Expect(rp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(decodeHandler.RequestCount.Load()).To(BeNumerically("==", 0))
+	})
+
+	It("should reject invalid status codes", func() {
+		_, err := NewProxy("0", decodeURL, Config{PrefillFallback: FallbackPolicy{StatusCodes: []string{"6xx"}}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,177 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	metricsNamespace = "llm_d_routing_sidecar"
+
+	// request outcomes
+	outcomeDisaggregated = "disaggregated"
+	outcomePassthrough   = "passthrough"
+	outcomeSSRFRejected  = "ssrf_rejected"
+	outcomePrefillFailed = "prefill_failed"
+	outcomeFallback      = "fallback"
+	outcomeTimeout       = "timeout"
+	outcomeCancelled     = "cancelled"
+	outcomeError         = "error"
+
+	// pipeline stages
+	stagePrefill = "prefill"
+	stageDecode  = "decode"
+)
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of completion requests by path, connector and outcome.",
+	}, []string{"path", "connector", "outcome"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Total latency of completion requests, until the response is fully sent.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"path", "connector", "outcome"})
+
+	prefillDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "prefill_duration_seconds",
+		Help:      "Latency of the remote prefill requests.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"connector"})
+
+	decodeTimeToFirstByte = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "decode_time_to_first_byte_seconds",
+		Help:      "Time until the local decoder sends the first response byte.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"connector"})
+
+	inFlightRequests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "in_flight_requests",
+		Help:      "Number of requests currently being processed by stage (prefill or decode).",
+	}, []string{"stage"})
+
+	prefillAbortsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "prefill_aborts_total",
+		Help:      "Number of requests releasing the prefiller KV cache of cancelled requests, by connector and result.",
+	}, []string{"connector", "result"})
+
+	prefillerProxyCacheTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "prefiller_proxy_cache_total",
+		Help:      "Number of prefiller proxy cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	kvTransferParamsInvalid = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "kv_transfer_params_invalid_total",
+		Help:      "Number of prefiller responses with missing or invalid kv_transfer_params, by reason and policy.",
+	}, []string{"reason", "policy"})
+
+	firstTokenMismatchTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "stream_first_token_mismatch_total",
+		Help:      "Number of streamed responses where the decoder first token differs from the prefiller one.",
+	})
+
+	certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry time of the certificates in use, by certificate (server or prefiller-client).",
+	}, []string{"certificate"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		prefillDuration,
+		decodeTimeToFirstByte,
+		inFlightRequests,
+		prefillAbortsTotal,
+		prefillerProxyCacheTotal,
+		kvTransferParamsInvalid,
+		firstTokenMismatchTotal,
+		certificateExpiry,
+	)
+}
+
+// MetricsHandler returns the handler exposing the sidecar metrics in the Prometheus format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// recordRequest records the outcome and total latency of a completion request
+func (s *Server) recordRequest(r *http.Request, outcome string, start time.Time) {
+	connector := s.currentConfig().Connector
+	requestsTotal.WithLabelValues(r.URL.Path, connector, outcome).Inc()
+	requestDuration.WithLabelValues(r.URL.Path, connector, outcome).Observe(time.Since(start).Seconds())
+	trace.SpanFromContext(r.Context()).SetAttributes(attributeOutcome.String(outcome))
+}
+
+// firstByteResponseWriter records when the first byte of a response is written, and its status code
+type firstByteResponseWriter struct {
+	http.ResponseWriter
+	start      time.Time
+	firstByte  time.Duration
+	statusCode int
+}
+
+func (w *firstByteResponseWriter) WriteHeader(statusCode int) {
+	w.observe()
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *firstByteResponseWriter) Write(b []byte) (int, error) {
+	w.observe()
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to flush streamed responses
+func (w *firstByteResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *firstByteResponseWriter) observe() {
+	if w.firstByte == 0 {
+		w.firstByte = time.Since(w.start)
+	}
+}
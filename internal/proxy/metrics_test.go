@@ -0,0 +1,99 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Metrics", func() {
+	It("should count requests by outcome and prefiller proxy cache lookups", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode})
+		DeferCleanup(decodeBackend.Close)
+		prefillBackend := httptest.NewServer(&mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill})
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+
+		counter := func(outcome string) float64 {
+			return testutil.ToFloat64(requestsTotal.WithLabelValues(CompletionsPath, ConnectorNIXLV2, outcome))
+		}
+		disaggregated := counter(outcomeDisaggregated)
+		passthrough := counter(outcomePassthrough)
+		misses := testutil.ToFloat64(prefillerProxyCacheTotal.WithLabelValues("miss"))
+		hits := testutil.ToFloat64(prefillerProxyCacheTotal.WithLabelValues("hit"))
+
+		send := func(prefillHostPort string) {
+			body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			if prefillHostPort != "" {
+				req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+			}
+			rp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rp.Body.Close()).To(Succeed())
+			Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		}
+
+		send("")
+		send(prefillBackend.URL[len("http://"):])
+		send(prefillBackend.URL[len("http://"):])
+
+		Expect(counter(outcomePassthrough)).To(Equal(passthrough + 1))
+		Expect(counter(outcomeDisaggregated)).To(Equal(disaggregated + 2))
+		Expect(testutil.ToFloat64(prefillerProxyCacheTotal.WithLabelValues("miss"))).To(Equal(misses + 1))
+		Expect(testutil.ToFloat64(prefillerProxyCacheTotal.WithLabelValues("hit"))).To(Equal(hits + 1))
+		Expect(testutil.ToFloat64(inFlightRequests.WithLabelValues(stagePrefill))).To(BeZero())
+
+		By("exposing the metrics in the Prometheus format")
+		rec := httptest.NewRecorder()
+		MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		b, err := io.ReadAll(rec.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring("llm_d_routing_sidecar_prefill_duration_seconds_bucket"))
+		Expect(string(b)).To(ContainSubstring("llm_d_routing_sidecar_decode_time_to_first_byte_seconds_bucket"))
+	})
+})
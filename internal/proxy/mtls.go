@@ -0,0 +1,149 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// newPrefillerTLSConfig returns the TLS configuration of the requests to prefillers: the prefillers are
+// verified with the CA bundle, or the system roots, and optionally their SANs, and the client certificate,
+// if any, is presented to them.
+func newPrefillerTLSConfig(config Config, clientCert *certificateReloader) (*tls.Config, error) {
+	tlsConfig := config.TLSProfile.newTLSConfig()
+	tlsConfig.InsecureSkipVerify = config.PrefillerInsecureSkipVerify
+
+	if config.PrefillerCAFile != "" {
+		roots, err := loadCertPool(config.PrefillerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the prefiller CA bundle: %w", err)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if clientCert != nil {
+		tlsConfig.GetClientCertificate = clientCert.getClientCertificate
+	}
+
+	if len(config.PrefillerAllowedSANs) > 0 {
+		// Prefillers are addressed by IP, which their certificates, e.g. SPIFFE SVIDs, usually do not
+		// include: the chain is verified without the host name, then the SANs are matched.
+		roots, allowedSANs, verifyChain := tlsConfig.RootCAs, config.PrefillerAllowedSANs, !tlsConfig.InsecureSkipVerify
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("prefiller presented no certificate")
+			}
+			leaf := state.PeerCertificates[0]
+			if verifyChain {
+				intermediates := x509.NewCertPool()
+				for _, cert := range state.PeerCertificates[1:] {
+					intermediates.AddCert(cert)
+				}
+				if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+					return err
+				}
+			}
+			if !matchSAN(leaf, allowedSANs) {
+				return fmt.Errorf("prefiller certificate SANs do not match any of %v", allowedSANs)
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// configureClientAuth configures the verification of the client certificates on the server TLS
+// configuration. Client certificates are verified if given during the handshake, so that probes
+// can reach the health endpoints without certificate; requireClientCert enforces them on the other
+// endpoints.
+func configureClientAuth(tlsConfig *tls.Config, config Config) error {
+	if config.ClientCAFile == "" {
+		return nil
+	}
+	clientCAs, err := loadCertPool(config.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the client CA bundle: %w", err)
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return nil
+}
+
+// requireClientCert rejects the requests without a verified client certificate, or whose certificate
+// SANs are not allowed, except on the health endpoints
+func (s *Server) requireClientCert(next http.Handler) http.Handler {
+	allowedSANs := s.currentConfig().ClientAllowedSANs
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case LivePath, ReadyPath, "/health":
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			s.requestLogger(r).V(4).Info("rejected request without client certificate", "remoteAddr", r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, errorCodeRequestClientCertificate, "", errors.New("client certificate required")) //nolint:all
+			return
+		}
+		if len(allowedSANs) > 0 && !matchSAN(r.TLS.VerifiedChains[0][0], allowedSANs) {
+			s.requestLogger(r).V(4).Info("rejected client certificate", "remoteAddr", r.RemoteAddr)
+			writeError(w, http.StatusForbidden, errorCodeRequestClientCertificate, "", errors.New("client certificate not allowed")) //nolint:all
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchSAN returns true when one of the certificate DNS, IP or URI (e.g. SPIFFE ID) SANs is allowed
+func matchSAN(cert *x509.Certificate, allowed []string) bool {
+	for _, name := range cert.DNSNames {
+		if slices.Contains(allowed, name) {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if slices.Contains(allowed, ip.String()) {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if slices.Contains(allowed, uri.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCertPool loads a PEM CA bundle
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
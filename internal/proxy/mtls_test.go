@@ -0,0 +1,299 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA() *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return &testCA{cert: cert, key: key, dir: GinkgoT().TempDir()}
+}
+
+// bundle writes the CA certificate and returns its path
+func (ca *testCA) bundle() string {
+	path := filepath.Join(ca.dir, "ca.crt")
+	Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0o600)).To(Succeed())
+	return path
+}
+
+// issue writes a certificate with the given SANs and returns it, along with the paths of its certificate and key
+func (ca *testCA) issue(name string, dnsNames []string, ips []net.IP, uris ...string) (tls.Certificate, string, string) {
+	return ca.issueUntil(name, time.Now().Add(time.Hour), dnsNames, ips, uris...)
+}
+
+// issueUntil is issue, with the given expiry time
+func (ca *testCA) issueUntil(name string, notAfter time.Time, dnsNames []string, ips []net.IP, uris ...string) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		Expect(err).ToNot(HaveOccurred())
+		template.URIs = append(template.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	certPath, keyPath := filepath.Join(ca.dir, name+".crt"), filepath.Join(ca.dir, name+".key")
+	Expect(os.WriteFile(certPath, certPEM, 0o600)).To(Succeed())
+	Expect(os.WriteFile(keyPath, keyPEM, 0o600)).To(Succeed())
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).ToNot(HaveOccurred())
+	return cert, certPath, keyPath
+}
+
+var _ = Describe("Mutual TLS", func() {
+	var ca *testCA
+
+	BeforeEach(func() {
+		ca = newTestCA()
+	})
+
+	Context("with prefillers", func() {
+		const prefillerID = "spiffe://cluster.local/ns/default/sa/prefill"
+
+		var (
+			prefiller *httptest.Server
+			certFile  string
+			keyFile   string
+		)
+
+		BeforeEach(func() {
+			// the prefiller certificate only has a SPIFFE ID, not its IP
+			serverCert, _, _ := ca.issue("prefiller", nil, nil, prefillerID)
+			clientCAs := x509.NewCertPool()
+			clientCAs.AddCert(ca.cert)
+
+			prefiller = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.TLS.PeerCertificates).To(HaveLen(1))
+				_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			}))
+			prefiller.TLS = &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientCAs:    clientCAs,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}
+			prefiller.StartTLS()
+			DeferCleanup(prefiller.Close)
+
+			_, certFile, keyFile = ca.issue("sidecar", []string{"sidecar"}, nil)
+		})
+
+		get := func(config Config) (string, error) {
+			var clientCert *certificateReloader
+			if config.PrefillerCertFile != "" {
+				var err error
+				clientCert, err = newCertificateReloader(logr.Discard(), certificatePrefillerClient, config.PrefillerCertFile, config.PrefillerKeyFile)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			tlsConfig, err := newPrefillerTLSConfig(config, clientCert)
+			Expect(err).ToNot(HaveOccurred())
+			client := &http.Client{Transport: newTransport(tlsConfig, 0, 0)}
+			resp, err := client.Get(prefiller.URL)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close() //nolint:all
+			body := make([]byte, 64)
+			n, _ := resp.Body.Read(body)
+			return string(body[:n]), nil
+		}
+
+		It("should present the client certificate and verify the prefiller SPIFFE ID", func() {
+			body, err := get(Config{
+				PrefillerCAFile:      ca.bundle(),
+				PrefillerCertFile:    certFile,
+				PrefillerKeyFile:     keyFile,
+				PrefillerAllowedSANs: []string{prefillerID},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(Equal("sidecar"))
+		})
+
+		It("should reject prefillers with other SANs", func() {
+			_, err := get(Config{
+				PrefillerCAFile:      ca.bundle(),
+				PrefillerCertFile:    certFile,
+				PrefillerKeyFile:     keyFile,
+				PrefillerAllowedSANs: []string{"spiffe://cluster.local/ns/default/sa/other"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("do not match")))
+		})
+
+		It("should verify the prefiller host name without allowed SANs", func() {
+			_, err := get(Config{PrefillerCAFile: ca.bundle(), PrefillerCertFile: certFile, PrefillerKeyFile: keyFile})
+			Expect(err).To(MatchError(ContainSubstring("127.0.0.1")))
+		})
+
+		It("should reject prefillers signed by another CA", func() {
+			_, err := get(Config{
+				PrefillerCAFile:      newTestCA().bundle(),
+				PrefillerCertFile:    certFile,
+				PrefillerKeyFile:     keyFile,
+				PrefillerAllowedSANs: []string{prefillerID},
+			})
+			Expect(err).To(MatchError(ContainSubstring("unknown authority")))
+		})
+
+		It("should fail without client certificate", func() {
+			_, err := get(Config{PrefillerCAFile: ca.bundle(), PrefillerAllowedSANs: []string{prefillerID}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject invalid files", func() {
+			_, err := newPrefillerTLSConfig(Config{PrefillerCAFile: keyFile}, nil)
+			Expect(err).To(MatchError(ContainSubstring("no certificate found")))
+
+			_, err = NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{PrefillerCertFile: certFile, PrefillerKeyFile: certFile})
+			Expect(err).To(MatchError(ContainSubstring("client certificate")))
+		})
+	})
+
+	Context("with clients", func() {
+		var proxyAddr string
+
+		startProxy := func(allowedSANs ...string) {
+			_, ctx := ktesting.NewTestContext(GinkgoT())
+			ctx, cancelFn := context.WithCancel(ctx)
+			DeferCleanup(cancelFn)
+
+			decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			DeferCleanup(decoder.Close)
+			decoderURL, err := url.Parse(decoder.URL)
+			Expect(err).ToNot(HaveOccurred())
+
+			// the proxy expects tls.crt and tls.key in the certificate directory
+			_, certFile, keyFile := ca.issue("tls", []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)})
+			Expect(filepath.Base(certFile)).To(Equal("tls.crt"))
+			Expect(filepath.Base(keyFile)).To(Equal("tls.key"))
+
+			proxy, err := NewProxy("0", decoderURL, Config{
+				SecureProxy:       true,
+				CertPath:          ca.dir,
+				ClientCAFile:      ca.bundle(),
+				ClientAllowedSANs: allowedSANs,
+			})
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				Expect(proxy.Start(ctx)).To(Succeed())
+			}()
+			waitForProxy(proxy)
+			proxyAddr = fmt.Sprintf("https://localhost:%d", proxy.addr.(*net.TCPAddr).Port)
+		}
+
+		get := func(path string, certs ...tls.Certificate) (int, error) {
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			client := &http.Client{Transport: newTransport(&tls.Config{RootCAs: roots, Certificates: certs}, 0, 0)}
+			resp, err := client.Get(proxyAddr + path)
+			if err != nil {
+				return 0, err
+			}
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode, nil
+		}
+
+		It("should require a client certificate, except on the health endpoints", func() {
+			startProxy()
+			gateway, _, _ := ca.issue("gateway", []string{"gateway"}, nil)
+
+			Expect(get("/v1/models")).To(Equal(http.StatusUnauthorized))
+			Expect(get(LivePath)).To(Equal(http.StatusOK))
+			Expect(get(ReadyPath)).To(Equal(http.StatusOK))
+			Expect(get("/v1/models", gateway)).To(Equal(http.StatusOK))
+
+			other, _, _ := newTestCA().issue("other", []string{"gateway"}, nil)
+			_, err := get("/v1/models", other)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should only allow the client certificates with the allowed SANs", func() {
+			startProxy("spiffe://cluster.local/ns/gateway/sa/gateway")
+			gateway, _, _ := ca.issue("gateway", nil, nil, "spiffe://cluster.local/ns/gateway/sa/gateway")
+			other, _, _ := ca.issue("other", nil, nil, "spiffe://cluster.local/ns/default/sa/other")
+
+			Expect(get("/v1/models", gateway)).To(Equal(http.StatusOK))
+			Expect(get("/v1/models", other)).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	It("should require the secure proxy for client certificates", func() {
+		_, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{ClientCAFile: ca.bundle()})
+		Expect(err).To(MatchError(ContainSubstring("secure proxy")))
+	})
+})
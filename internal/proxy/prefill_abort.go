@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// prefillAbortTimeout bounds the request releasing the prefiller KV cache. It is sent after
+// the client went away, so it cannot rely on the client request context.
+const prefillAbortTimeout = 5 * time.Second
+
+// abort results
+const (
+	abortResultSuccess = "success"
+	abortResultFailure = "failure"
+)
+
+// clientCancelled returns true when the client disconnected. Deadline expirations are not cancellations.
+func clientCancelled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// abortPrefill asks the prefiller which served the prefill to release the KV cache it holds for
+// the decoder, when the connector supports it.
+func (s *Server) abortPrefill(r *http.Request, hostPort string, prefillState map[string]any) {
+	aborter, ok := s.connector.(PrefillAborter)
+	if !ok {
+		return
+	}
+
+	connector := s.currentConfig().Connector
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), prefillAbortTimeout)
+	defer cancel()
+	logger := klog.FromContext(ctx)
+
+	areq := r.Clone(ctx)
+	abortRequest, err := aborter.PrepareAbort(ctx, areq, prefillState)
+	if err != nil {
+		logger.Error(err, "failed to prepare prefill abort request", "url", hostPort)
+		prefillAbortsTotal.WithLabelValues(connector, abortResultFailure).Inc()
+		return
+	}
+	if abortRequest == nil {
+		return
+	}
+
+	abody, err := json.Marshal(abortRequest)
+	if err != nil {
+		logger.Error(err, "failed to marshal prefill abort request", "url", hostPort)
+		prefillAbortsTotal.WithLabelValues(connector, abortResultFailure).Inc()
+		return
+	}
+
+	handler, err := s.prefillerProxyHandler(hostPort)
+	if err != nil {
+		prefillAbortsTotal.WithLabelValues(connector, abortResultFailure).Inc()
+		return
+	}
+
+	areq.Method = http.MethodPost
+	areq.Body = io.NopCloser(bytes.NewReader(abody))
+	areq.ContentLength = int64(len(abody))
+	injectTraceContext(ctx, areq)
+
+	logger.V(4).Info("releasing prefiller KV cache", "url", hostPort, "path", areq.URL.Path)
+	aw := &bufferedResponseWriter{}
+	defer aw.release()
+	handler.ServeHTTP(aw, areq)
+	if aw.statusCode < 200 || aw.statusCode >= 300 {
+		logger.Error(aw.err, "prefill abort request failed", "url", hostPort, "code", aw.statusCode, "body", string(aw.Bytes()))
+		prefillAbortsTotal.WithLabelValues(connector, abortResultFailure).Inc()
+		return
+	}
+	prefillAbortsTotal.WithLabelValues(connector, abortResultSuccess).Inc()
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/klog/v2"
+)
+
+// runConnectorProtocol drives a disaggregated request through the configured connector.
+// The prefill request is sent to the candidate prefillers in order, until one succeeds or
+// fails with a non-retryable error. It returns the request outcome.
+func (s *Server) runConnectorProtocol(w http.ResponseWriter, r *http.Request, prefillHostPorts []string) string {
+	ctx := r.Context()
+	logger := klog.FromContext(ctx)
+	config := s.currentConfig()
+	logger.V(4).Info("running P/D protocol", "connector", config.Connector, "urls", prefillHostPorts)
+
+	// Read request body
+	defer r.Body.Close() //nolint:all
+	body, err := readRequestBody(r)
+	if err != nil {
+		if limit, ok := bodyTooLarge(err); ok {
+			if err := writeError(w, http.StatusRequestEntityTooLarge, errorCodeRequestTooLarge, "", errBodyTooLarge(limit)); err != nil {
+				logger.Error(err, "failed to send error response to client")
+			}
+			return outcomeError
+		}
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomeError
+	}
+	defer body.release()
+	original := body.Bytes()
+
+	// Parse completion request
+	completionRequest, err := ParseCompletionRequest(original)
+	if err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomeError
+	}
+
+	// Prefill Stage
+
+	// 1. Prepare prefill request
+	preq := r.Clone(ctx)
+
+	if err := s.connector.PreparePrefill(ctx, preq, completionRequest); err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomeError
+	}
+
+	pbody := completionRequest.requestBody(body)
+	defer pbody.release()
+
+	// 2. Forward request to the prefiller candidates, in order, until one succeeds
+	var (
+		pw              *bufferedResponseWriter
+		prefillSpan     trace.Span
+		prefillHostPort string
+		attempts        int
+	)
+	for _, prefillHostPort = range prefillHostPorts {
+		attempts++
+		if logger.V(5).Enabled() {
+			logger.V(5).Info("sending request to prefiller", "url", prefillHostPort, "attempt", attempts, "body", string(pbody.Bytes()))
+		}
+		if pw != nil {
+			pw.release() // the failed attempt response is no longer needed
+		}
+		pw, prefillSpan = s.sendPrefill(ctx, preq, pbody, prefillHostPort)
+		if !retryablePrefillFailure(pw) || attempts == len(prefillHostPorts) || ctx.Err() != nil {
+			break
+		}
+
+		logger.Info("prefill failed, trying next prefiller", "url", prefillHostPort, "attempt", attempts, "code", pw.statusCode, "error", pw.err)
+		prefillSpan.SetAttributes(semconv.HTTPResponseStatusCode(pw.statusCode))
+		if pw.err != nil {
+			prefillSpan.RecordError(pw.err)
+		}
+		prefillSpan.SetStatus(codes.Error, http.StatusText(pw.statusCode))
+		prefillSpan.End()
+	}
+	defer pw.release()
+	w.Header().Set(responseHeaderPrefillAttempts, strconv.Itoa(attempts))
+
+	prefillSpan.SetAttributes(semconv.HTTPResponseStatusCode(pw.statusCode))
+	if clientCancelled(ctx) {
+		// the prefill request was cancelled with the client request: vLLM already released its KV cache
+		logger.V(4).Info("client disconnected during prefill", "url", prefillHostPort, "attempts", attempts)
+		prefillSpan.SetStatus(codes.Error, context.Canceled.Error())
+		prefillSpan.End()
+		return outcomeCancelled
+	}
+	if pw.statusCode < 200 || pw.statusCode >= 300 {
+		logger.Error(pw.err, "request failed", "code", pw.statusCode, "url", prefillHostPort, "attempts", attempts)
+		if pw.err != nil {
+			prefillSpan.RecordError(pw.err)
+		}
+		prefillSpan.SetStatus(codes.Error, http.StatusText(pw.statusCode))
+		prefillSpan.End()
+		if errors.Is(pw.err, errTargetNotAllowed) {
+			if err := writeError(w, http.StatusForbidden, errorCodeRequestSSRFRejected, "", errTargetNotAllowed); err != nil {
+				logger.Error(err, "failed to send error response to client")
+			}
+			return outcomeSSRFRejected
+		}
+		if s.shouldFallback(r, pw) {
+			s.runLocalPrefill(w, r, body, prefillFailureReason(pw))
+			return outcomeFallback
+		}
+		if pw.err != nil && isTimeout(pw.err) {
+			if err := writeError(w, http.StatusGatewayTimeout, errorCodePrefillTimeout, "", fmt.Errorf("prefill timed out: %w", pw.err)); err != nil {
+				logger.Error(err, "failed to send error response to client")
+			}
+			return outcomeTimeout
+		}
+		if pw.err != nil {
+			if err := writeError(w, http.StatusBadGateway, errorCodePrefillUnavailable, "", fmt.Errorf("prefill failed: %w", pw.err)); err != nil {
+				logger.Error(err, "failed to send error response to client")
+			}
+			return outcomePrefillFailed
+		}
+		if err := writePrefillError(w, pw); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomePrefillFailed
+	}
+
+	// 3. Process response - extract p/d fields
+	prefillState, err := s.connector.InterpretPrefillResponse(ctx, pw.Bytes())
+	if err != nil {
+		logger.Error(err, "invalid prefiller response")
+		prefillSpan.RecordError(err)
+		prefillSpan.SetStatus(codes.Error, "invalid prefiller response")
+		prefillSpan.End()
+		var invalidErr *InvalidPrefillResponseError
+		isInvalid := errors.As(err, &invalidErr)
+		if (config.PrefillFallback.Enabled || isInvalid && invalidErr.Fallback) && r.Context().Err() == nil {
+			s.runLocalPrefill(w, r, body, fallbackReasonInvalidResponse)
+			return outcomeFallback
+		}
+		param := ""
+		if isInvalid {
+			param = invalidErr.Param
+		}
+		if err := writeError(w, http.StatusBadGateway, errorCodePrefillInvalidResponse, param, err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomePrefillFailed
+	}
+
+	prefillSpan.SetAttributes(attributeKVBlockCount.Int(kvBlockCount(prefillState)))
+	prefillSpan.End()
+
+	logger.V(4).Info("prefill succeeded", "url", prefillHostPort, "attempts", attempts)
+	w.Header().Set(responseHeaderPrefillHostPort, prefillHostPort)
+
+	// Decode Stage
+
+	// 1. Prepare decode request, starting again from the original request
+	decodeRequest, err := ParseCompletionRequest(original)
+	if err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomeError
+	}
+
+	dreq := r.Clone(ctx)
+
+	if err := s.connector.PrepareDecode(ctx, dreq, decodeRequest, prefillState); err != nil {
+		if err := writeError(w, http.StatusBadRequest, errorCodeRequestInvalid, "", err); err != nil {
+			logger.Error(err, "failed to send error response to client")
+		}
+		return outcomeError
+	}
+
+	dbody := decodeRequest.requestBody(body)
+	defer dbody.release()
+	dreq.Body = dbody.reader()
+	dreq.ContentLength = dbody.Len()
+
+	// 2. Forward to local decoder, unless the client went away in the meantime
+	if clientCancelled(ctx) {
+		logger.V(4).Info("client disconnected before decode, releasing prefiller KV cache", "url", prefillHostPort)
+		s.abortPrefill(r, prefillHostPort, prefillState)
+		return outcomeCancelled
+	}
+
+	if logger.V(5).Enabled() {
+		logger.V(5).Info("sending request to decoder", "body", string(dbody.Bytes()))
+	}
+	if config.StreamFirstToken && streamFirstTokenEligible(decodeRequest) {
+		sw := newFirstTokenStreamWriter(w, logger, r.URL.Path == ChatCompletionsPath, pw.Bytes())
+		if sw != nil {
+			logger.V(4).Info("streaming prefiller first token")
+			if err := sw.writeFirstToken(); err != nil {
+				logger.Error(err, "failed to send first token to client")
+				return outcomeError
+			}
+			s.serveDecode(sw, dreq)
+			if err := sw.finish(); err != nil {
+				logger.Error(err, "failed to send response to client")
+			}
+			return outcomeDisaggregated
+		}
+	}
+
+	s.serveDecode(w, dreq)
+	return outcomeDisaggregated
+}
+
+// sendPrefill sends the prefill request to the given prefiller. The returned span must be ended
+// by the caller once the response is processed.
+func (s *Server) sendPrefill(ctx context.Context, preq *http.Request, pbody *requestBody, hostPort string) (*bufferedResponseWriter, trace.Span) {
+	pctx, span := tracer().Start(ctx, spanNamePrefill,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(hostPort)))
+
+	config := s.currentConfig()
+	if config.PrefillTimeout > 0 {
+		var cancel context.CancelFunc
+		pctx, cancel = context.WithTimeout(pctx, config.PrefillTimeout)
+		defer cancel()
+	}
+
+	pw := &bufferedResponseWriter{}
+	prefillHandler, err := s.prefillerProxyHandler(hostPort)
+	if err != nil {
+		pw.err = err
+		pw.statusCode = http.StatusBadGateway
+		span.RecordError(err)
+		return pw, span
+	}
+
+	req := preq.Clone(pctx)
+	req.Body = pbody.reader()
+	req.ContentLength = pbody.Len()
+	injectTraceContext(pctx, req)
+
+	prefillStart := time.Now()
+	inFlightRequests.WithLabelValues(stagePrefill).Inc()
+	prefillHandler.ServeHTTP(pw, req)
+	inFlightRequests.WithLabelValues(stagePrefill).Dec()
+	prefillDuration.WithLabelValues(config.Connector).Observe(time.Since(prefillStart).Seconds())
+
+	return pw, span
+}
+
+// retryablePrefillFailure returns true when the prefill failed because the prefiller is unreachable,
+// timed out or returned a 5xx status code
+func retryablePrefillFailure(pw *bufferedResponseWriter) bool {
+	return pw.err != nil || pw.statusCode >= http.StatusInternalServerError
+}
@@ -26,29 +26,41 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-logr/logr"
 	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/klog/v2"
 )
 
 const (
-	requestHeaderPrefillURL      = "x-prefiller-url"
-	requestHeaderPrefillHostPort = "x-prefiller-host-port"
-	requestHeaderRequestID       = "x-request-id"
-
-	requestFieldKVTransferParams = "kv_transfer_params"
-	requestFieldMaxTokens        = "max_tokens"
-	requestFieldDoRemotePrefill  = "do_remote_prefill"
-	requestFieldDoRemoteDecode   = "do_remote_decode"
-	requestFieldRemoteBlockIDs   = "remote_block_ids"
-	requestFieldRemoteEngineID   = "remote_engine_id"
-	requestFieldRemoteHost       = "remote_host"
-	requestFieldRemotePort       = "remote_port"
-	requestFieldStream           = "stream"
-	requestFieldStreamOptions    = "stream_options"
+	requestHeaderPrefillURL        = "x-prefiller-url"
+	requestHeaderPrefillHostPort   = "x-prefiller-host-port"
+	requestHeaderPrefillAlternates = "x-prefiller-alternate-host-ports"
+	requestHeaderRequestID         = "x-request-id"
+	requestHeaderRequestDeadline   = "x-request-deadline"
+
+	responseHeaderPrefillAttempts = "x-prefill-attempts"
+	responseHeaderPrefillHostPort = "x-prefill-host-port"
+
+	requestFieldKVTransferParams    = "kv_transfer_params"
+	requestFieldMaxTokens           = "max_tokens"
+	requestFieldMaxCompletionTokens = "max_completion_tokens"
+	requestFieldMinTokens           = "min_tokens"
+	requestFieldDoRemotePrefill     = "do_remote_prefill"
+	requestFieldDoRemoteDecode      = "do_remote_decode"
+	requestFieldRemoteBlockIDs      = "remote_block_ids"
+	requestFieldRemoteEngineID      = "remote_engine_id"
+	requestFieldRemoteHost          = "remote_host"
+	requestFieldRemotePort          = "remote_port"
+	requestFieldStream              = "stream"
+	requestFieldStreamOptions       = "stream_options"
 
 	// ConnectorNIXLV1 enables the (now deprecated) P/D NIXL v1 protocol
 	ConnectorNIXLV1 = "nixl"
@@ -63,8 +75,12 @@ const (
 // Config represents the proxy server configuration
 type Config struct {
 	// Connector is the name of the P/D protocol the proxy must follow.
+	// It must be one of the registered connectors. Defaults to ConnectorNIXLV2.
 	Connector string
 
+	// ConnectorOptions holds the connector-specific options.
+	ConnectorOptions map[string]string
+
 	// PrefillerUseTLS indicates whether to use TLS when sending requests to prefillers.
 	PrefillerUseTLS bool
 
@@ -74,6 +90,9 @@ type Config struct {
 	// CertPath is the location of the TLS certificates
 	CertPath string
 
+	// SelfSignedCert configures the certificate generated when SecureProxy is set without CertPath.
+	SelfSignedCert SelfSignedCertConfig
+
 	// PrefillerInsecureSkipVerify configure the proxy to skip TLS verification for requests to prefiller.
 	PrefillerInsecureSkipVerify bool
 
@@ -88,32 +107,144 @@ type Config struct {
 
 	// InferencePoolName InferencePool object name.
 	InferencePoolName string
-}
 
-type protocolRunner func(http.ResponseWriter, *http.Request, string)
+	// PrefillerCAFile is the path of the PEM CA bundle verifying the prefiller certificates. The system roots
+	// are used when empty.
+	PrefillerCAFile string
+
+	// PrefillerCertFile and PrefillerKeyFile are the paths of the client certificate and key presented to prefillers.
+	PrefillerCertFile string
+	PrefillerKeyFile  string
+
+	// PrefillerAllowedSANs lists the DNS, IP or URI (e.g. SPIFFE ID) SANs allowed in the prefiller certificates.
+	// When set, the prefiller certificates are verified without matching the host name. Any SAN is allowed when empty.
+	PrefillerAllowedSANs []string
+
+	// ClientCAFile is the path of the PEM CA bundle verifying the client certificates. When set, requests without
+	// a valid client certificate are rejected, except on the health endpoints.
+	ClientCAFile string
+
+	// ClientAllowedSANs lists the DNS, IP or URI SANs allowed in the client certificates. Any SAN is allowed when empty.
+	ClientAllowedSANs []string
+
+	// TLSProfile configures the TLS versions, cipher suites and curves of the listener, and of the connections
+	// to the decoder and prefillers.
+	TLSProfile TLSProfile
+
+	// AllowlistPorts configures the ports allowed on the InferencePool pods by the SSRF protection.
+	AllowlistPorts PortPolicy
+
+	// AllowlistFile is the path of a file listing the hostnames, IPs and CIDRs allowed by the SSRF protection,
+	// in addition to the InferencePool pods.
+	AllowlistFile string
+
+	// AllowlistEndpointSliceService is the name of a Service selecting the InferencePool pods. When set, the
+	// SSRF protection allows the ready endpoints of its EndpointSlices instead of watching the pool pods.
+	AllowlistEndpointSliceService string
+
+	// AllowlistSyncTimeout bounds the wait for the InferencePool allowlist to sync at startup. Zero means no wait.
+	AllowlistSyncTimeout time.Duration
+
+	// AllowlistSyncPolicy is AllowlistSyncFailClosed (the default) to reject, or AllowlistSyncFailOpen to allow,
+	// the prefill targets while the InferencePool allowlist is syncing.
+	AllowlistSyncPolicy string
+
+	// MetricsPort is the port serving the Prometheus metrics on /metrics. Metrics are not served when empty.
+	// A dedicated port is used so the decoder metrics stay reachable on the proxy port.
+	MetricsPort string
+
+	// StreamFirstToken enables streaming the prefiller first token to streaming clients while the
+	// decoder warms up. It only applies to requests with greedy or seeded sampling.
+	StreamFirstToken bool
+
+	// PrefillConnectTimeout bounds the connection (dial and TLS handshake) to prefillers. Zero means no timeout.
+	PrefillConnectTimeout time.Duration
+
+	// PrefillTimeout bounds each prefill request, from connection to the end of the response. Zero means no timeout.
+	PrefillTimeout time.Duration
+
+	// DecodeFirstByteTimeout bounds the wait for the decoder response headers. Zero means no timeout.
+	DecodeFirstByteTimeout time.Duration
+
+	// PrefillFallback configures the fallback to local prefill when the remote prefill fails.
+	PrefillFallback FallbackPolicy
+
+	// MaxRequestBodySize is the maximum size, in bytes, of the completion request bodies. Larger requests are
+	// rejected with 413 Request Entity Too Large. Zero means no limit.
+	MaxRequestBodySize int64
+
+	// DecoderProbeInterval is how often the decoder health is probed for the readiness endpoint.
+	// Zero disables the probe: the readiness then ignores the decoder health.
+	DecoderProbeInterval time.Duration
+}
 
 // Server is the reverse proxy server
 type Server struct {
-	logger               logr.Logger
-	addr                 net.Addr       // the proxy TCP address
-	port                 string         // the proxy TCP port
-	decoderURL           *url.URL       // the local decoder URL
-	decoderProxy         http.Handler   // decoder proxy handler
-	runConnectorProtocol protocolRunner // the handler for running the protocol
-	prefillerURLPrefix   string
-	allowlistValidator   *AllowlistValidator // SSRF protection validator
+	logger             logr.Logger
+	addr               net.Addr            // the proxy TCP address, set before ready is closed
+	ready              chan struct{}       // closed once the proxy is about to serve requests
+	port               string              // the proxy TCP port
+	decoderURL         *url.URL            // the local decoder URL
+	connector          Connector           // the P/D protocol implementation
+	allowlistValidator *AllowlistValidator // SSRF protection validator
 
 	prefillerProxies *lru.Cache[string, http.Handler] // cached prefiller proxy handlers
 
-	config Config
+	decoderHealth atomic.Pointer[decoderHealth] // result of the last decoder probe, nil until the first probe
+
+	// certificates and CA bundles reloaded when their files change, or renewed
+	serverTLSConfig atomic.Pointer[tls.Config]
+	serverCert      *certificateReloader
+	selfSigned      *selfSignedIssuer
+	prefillerCert   *certificateReloader
+	clientCA        *watchedFile
+	prefillerCA     *watchedFile
+
+	mu                 sync.RWMutex // guards config, decoderProxy and prefillerTLSConfig, which are updated by Reconfigure
+	decoderProxy       *httputil.ReverseProxy
+	prefillerTLSConfig *tls.Config
+	config             Config
 }
 
 // NewProxy creates a new routing reverse proxy
 func NewProxy(port string, decodeURL *url.URL, config Config) (*Server, error) {
 	cache, _ := lru.New[string, http.Handler](16) // nolint:all
 
+	if config.Connector == "" {
+		config.Connector = ConnectorNIXLV2
+	}
+	connector, err := NewConnector(config.Connector, config.ConnectorOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.PrefillFallback.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid prefill fallback policy: %w", err)
+	}
+
+	if err := config.TLSProfile.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SelfSignedCert.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid self-signed certificate configuration: %w", err)
+	}
+
+	if config.ClientCAFile != "" && !config.SecureProxy {
+		return nil, errors.New("client certificate verification requires the secure proxy")
+	}
+	var prefillerCert *certificateReloader
+	if config.PrefillerCertFile != "" || config.PrefillerKeyFile != "" {
+		if prefillerCert, err = newCertificateReloader(klog.Background(), certificatePrefillerClient, config.PrefillerCertFile, config.PrefillerKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to load the prefiller client certificate: %w", err)
+		}
+	}
+	prefillerTLSConfig, err := newPrefillerTLSConfig(config, prefillerCert)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create SSRF protection validator
-	validator, err := NewAllowlistValidator(config.EnableSSRFProtection, config.InferencePoolNamespace, config.InferencePoolName)
+	validator, err := NewAllowlistValidator(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create SSRF protection validator: %w", err)
 	}
@@ -121,24 +252,23 @@ func NewProxy(port string, decodeURL *url.URL, config Config) (*Server, error) {
 	server := &Server{
 		port:               port,
 		decoderURL:         decodeURL,
+		connector:          connector,
 		prefillerProxies:   cache,
-		prefillerURLPrefix: "http://",
 		allowlistValidator: validator,
+		prefillerTLSConfig: prefillerTLSConfig,
+		prefillerCert:      prefillerCert,
 		config:             config,
+		ready:              make(chan struct{}),
 	}
-	switch config.Connector {
-	case ConnectorLMCache:
-		server.runConnectorProtocol = server.runLMCacheProtocol
-	case ConnectorNIXLV1:
-		server.runConnectorProtocol = server.runNIXLProtocolV1
-	case ConnectorNIXLV2:
-		fallthrough
-	default:
-		server.runConnectorProtocol = server.runNIXLProtocolV2
+	if config.PrefillerCAFile != "" {
+		if server.prefillerCA, err = newWatchedFile(config.PrefillerCAFile); err != nil {
+			return nil, err
+		}
 	}
-
-	if config.PrefillerUseTLS {
-		server.prefillerURLPrefix = "https://"
+	if config.ClientCAFile != "" {
+		if server.clientCA, err = newWatchedFile(config.ClientCAFile); err != nil {
+			return nil, err
+		}
 	}
 
 	return server, nil
@@ -165,8 +295,24 @@ func (s *Server) Start(ctx context.Context) error {
 	// Configure handlers
 	mux := s.createRoutes()
 
+	config := s.currentConfig()
+	if config.DecoderProbeInterval > 0 {
+		go s.probeDecoder(ctx, config.DecoderProbeInterval)
+	}
+	if config.MetricsPort != "" {
+		if err := s.startMetricsServer(ctx); err != nil {
+			logger.Error(err, "Failed to start metrics server")
+			return err
+		}
+	}
+
+	var handler http.Handler = mux
+	if config.ClientCAFile != "" {
+		handler = s.requireClientCert(mux)
+	}
+
 	server := &http.Server{
-		Handler: mux,
+		Handler: handler,
 		// No ReadTimeout/WriteTimeout for LLM inference - can take hours for large contexts
 		IdleTimeout:       300 * time.Second, // 5 minutes for keep-alive connections
 		ReadHeaderTimeout: 30 * time.Second,  // Reasonable for headers only
@@ -174,31 +320,22 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	// Create TLS certificates
-	if s.config.SecureProxy {
-		var cert tls.Certificate
-		if s.config.CertPath != "" {
-			cert, err = tls.LoadX509KeyPair(s.config.CertPath+"/tls.crt", s.config.CertPath+"/tls.key")
-		} else {
-			cert, err = CreateSelfSignedTLSCertificate()
-		}
+	if config.SecureProxy {
+		tlsConfig, err := s.newServerTLSConfig(config)
 		if err != nil {
 			logger.Error(err, "failed to create TLS certificate")
 			return err
 		}
+		s.serverTLSConfig.Store(tlsConfig)
+		// the configuration is looked up on each handshake, so that a reloaded client CA bundle is used
 		server.TLSConfig = &tls.Config{
-			Certificates: []tls.Certificate{cert},
-			MinVersion:   tls.VersionTLS12,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return s.serverTLSConfig.Load(), nil
 			},
 		}
-		logger.Info("server TLS configured")
+		logger.Info("server TLS configured", "clientAuth", config.ClientCAFile != "")
 	}
+	go s.watchCertificates(ctx, certificateReloadInterval)
 
 	// Setup graceful termination (not strictly needed for sidecars)
 	go func() {
@@ -216,7 +353,8 @@ func (s *Server) Start(ctx context.Context) error {
 	}()
 
 	logger.Info("starting", "addr", s.addr.String())
-	if s.config.SecureProxy {
+	close(s.ready)
+	if config.SecureProxy {
 		if err := server.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
 			logger.Error(err, "failed to start")
 			return err
@@ -239,77 +377,214 @@ func (s *Server) createRoutes() *http.ServeMux {
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.HandleFunc("GET "+ReadyPath, s.readyHandler)
+	mux.HandleFunc("GET "+LivePath, s.liveHandler)
 	mux.HandleFunc("POST "+ChatCompletionsPath, s.chatCompletionsHandler) // /v1/chat/completions (openai)
 	mux.HandleFunc("POST "+CompletionsPath, s.chatCompletionsHandler)     // /v1/completions (legacy)
 
 	// Passthrough decoder handler
+	s.mu.Lock()
+	s.decoderProxy = s.newDecoderProxy(s.config)
+	s.mu.Unlock()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.currentDecoderProxy().ServeHTTP(w, r)
+	})
+
+	return mux
+}
+
+// newDecoderProxy creates the handler forwarding requests to the local decoder
+func (s *Server) newDecoderProxy(config Config) *httputil.ReverseProxy {
 	decoderProxy := httputil.NewSingleHostReverseProxy(s.decoderURL)
+	var decoderTLSConfig *tls.Config
 	if s.decoderURL.Scheme == "https" {
-		decoderProxy.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: s.config.DecoderInsecureSkipVerify,
-				MinVersion:         tls.VersionTLS12,
-				CipherSuites: []uint16{
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-				},
-			},
+		decoderTLSConfig = config.TLSProfile.newTLSConfig()
+		decoderTLSConfig.InsecureSkipVerify = config.DecoderInsecureSkipVerify
+	}
+	decoderProxy.Transport = newTransport(decoderTLSConfig, 0, config.DecodeFirstByteTimeout)
+	decoderProxy.ModifyResponse = func(resp *http.Response) error {
+		// The completion handlers already set x-request-id on the response, drop the copy
+		// echoed by vLLM (--enable-request-id-headers) so that clients receive it once
+		if path := resp.Request.URL.Path; path == ChatCompletionsPath || path == CompletionsPath {
+			resp.Header.Del(requestHeaderRequestID)
 		}
+		return nil
 	}
-	decoderProxy.ErrorHandler = func(res http.ResponseWriter, _ *http.Request, err error) {
+	decoderProxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
+		logger := s.requestLogger(req)
 
 		// Log errors from the decoder proxy
+		var sendErr error
+		limit, tooLarge := bodyTooLarge(err)
 		switch {
-		case errors.Is(err, syscall.ECONNREFUSED):
-			s.logger.Error(err, "waiting for vLLM to be ready")
+		case tooLarge:
+			logger.V(4).Info("request body too large", "limit", limit)
+			sendErr = writeError(res, http.StatusRequestEntityTooLarge, errorCodeRequestTooLarge, "", errBodyTooLarge(limit))
+		case isTimeout(err):
+			logger.Error(err, "decoder timed out")
+			sendErr = writeError(res, http.StatusGatewayTimeout, errorCodeDecodeTimeout, "", fmt.Errorf("decode timed out: %w", err))
 		default:
-			s.logger.Error(err, "http: proxy error")
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				logger.Error(err, "waiting for vLLM to be ready")
+			} else {
+				logger.Error(err, "http: proxy error")
+			}
+			sendErr = writeError(res, http.StatusBadGateway, errorCodeDecodeUnavailable, "", fmt.Errorf("decode failed: %w", err))
+		}
+		if sendErr != nil {
+			logger.Error(sendErr, "failed to send error response to client")
 		}
-		res.WriteHeader(http.StatusBadGateway)
 	}
-	s.decoderProxy = decoderProxy
-	mux.Handle("/", s.decoderProxy)
+	return decoderProxy
+}
 
-	return mux
+// currentDecoderProxy returns the handler forwarding requests to the local decoder
+func (s *Server) currentDecoderProxy() *httputil.ReverseProxy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.decoderProxy
+}
+
+// currentConfig returns the current server configuration
+func (s *Server) currentConfig() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// startMetricsServer serves the Prometheus metrics on a dedicated port until ctx is done
+func (s *Server) startMetricsServer(ctx context.Context) error {
+	ln, err := net.Listen("tcp", ":"+s.currentConfig().MetricsPort)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", MetricsHandler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := server.Close(); err != nil {
+			s.logger.Error(err, "failed to close metrics server")
+		}
+	}()
+
+	go func() {
+		s.logger.Info("starting metrics server", "addr", ln.Addr().String())
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error(err, "metrics server failed")
+		}
+	}()
+	return nil
+}
+
+// requestLogger returns the logger of the request, carrying its request ID, or the server logger
+func (s *Server) requestLogger(r *http.Request) logr.Logger {
+	if logger, err := logr.FromContext(r.Context()); err == nil {
+		return logger
+	}
+	return s.logger
+}
+
+// serveDecode forwards the request to the local decoder
+func (s *Server) serveDecode(w http.ResponseWriter, r *http.Request) {
+	inFlightRequests.WithLabelValues(stageDecode).Inc()
+	defer inFlightRequests.WithLabelValues(stageDecode).Dec()
+
+	ctx, span := tracer().Start(r.Context(), spanNameDecode,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(s.decoderURL.Host)))
+	defer span.End()
+	r = r.WithContext(ctx)
+	injectTraceContext(ctx, r)
+
+	fw := &firstByteResponseWriter{ResponseWriter: w, start: time.Now()}
+	s.currentDecoderProxy().ServeHTTP(fw, r)
+	if fw.firstByte > 0 {
+		decodeTimeToFirstByte.WithLabelValues(s.currentConfig().Connector).Observe(fw.firstByte.Seconds())
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(fw.statusCode))
+	if fw.statusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(fw.statusCode))
+	}
 }
 
 func (s *Server) prefillerProxyHandler(hostPort string) (http.Handler, error) {
+	// hold the lock until the handler is cached, so that Reconfigure does not miss it when purging the cache
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	proxy, exists := s.prefillerProxies.Get(hostPort)
 	if exists {
+		prefillerProxyCacheTotal.WithLabelValues("hit").Inc()
 		return proxy, nil
 	}
+	prefillerProxyCacheTotal.WithLabelValues("miss").Inc()
 
 	// Backward compatible behavior: trim `http:` prefix
 	hostPort, _ = strings.CutPrefix(hostPort, "http://")
 
-	u, err := url.Parse(s.prefillerURLPrefix + hostPort)
+	prefillerURLPrefix := "http://"
+	if s.config.PrefillerUseTLS {
+		prefillerURLPrefix = "https://"
+	}
+	u, err := url.Parse(prefillerURLPrefix + hostPort)
 	if err != nil {
 		s.logger.Error(err, "failed to parse URL", "hostPort", hostPort)
 		return nil, err
 	}
 
 	newProxy := httputil.NewSingleHostReverseProxy(u)
-	if u.Scheme == "https" {
-		newProxy.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: s.config.PrefillerInsecureSkipVerify,
-				MinVersion:         tls.VersionTLS12,
-				CipherSuites: []uint16{
-					tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-					tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-					tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-					tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-				},
-			},
+	newProxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
+		s.requestLogger(req).Error(err, "prefiller proxy error", "hostPort", hostPort)
+		if pw, ok := res.(*bufferedResponseWriter); ok {
+			pw.err = err
 		}
+		res.WriteHeader(http.StatusBadGateway)
+	}
+	var prefillerTLSConfig *tls.Config
+	if u.Scheme == "https" {
+		prefillerTLSConfig = s.prefillerTLSConfig
+	}
+	newProxy.Transport = newTransport(prefillerTLSConfig, s.config.PrefillConnectTimeout, 0)
+	if control := s.allowlistValidator.dialControl(); control != nil {
+		// IsAllowed checked the target name: check the address actually dialed too
+		newProxy.Transport.(*http.Transport).DialContext = newDialer(s.config.PrefillConnectTimeout, control).DialContext
 	}
 	s.prefillerProxies.Add(hostPort, newProxy)
 
 	return newProxy, nil
 }
+
+// newTransport returns a transport with the default settings, the given TLS configuration and timeouts.
+// connectTimeout bounds the dial and TLS handshake; responseHeaderTimeout bounds the wait for the
+// response headers once the request is sent. A zero timeout means no timeout.
+func newTransport(tlsConfig *tls.Config, connectTimeout, responseHeaderTimeout time.Duration) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if connectTimeout > 0 {
+		transport.DialContext = newDialer(connectTimeout, nil).DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	return transport
+}
+
+// newDialer returns a dialer with the default settings, the given connect timeout and control function.
+// A zero timeout keeps the default one.
+func newDialer(connectTimeout time.Duration, control func(ctx context.Context, network, address string, c syscall.RawConn) error) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:        30 * time.Second,
+		KeepAlive:      30 * time.Second,
+		ControlContext: control,
+	}
+	if connectTimeout > 0 {
+		dialer.Timeout = connectTimeout
+	}
+	return dialer
+}
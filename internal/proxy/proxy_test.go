@@ -32,6 +32,12 @@ import (
 	"k8s.io/klog/v2/ktesting"
 )
 
+// waitForProxy waits for the proxy started in the background to serve requests. Generating the
+// self-signed certificate of the secure proxy may take several seconds with the race detector.
+func waitForProxy(proxy *Server) {
+	Eventually(proxy.ready).WithTimeout(30 * time.Second).Should(BeClosed())
+}
+
 var _ = Describe("Reverse Proxy", func() {
 	When("x-prefiller-url is not present", func() {
 		DescribeTable("should forward requests to decode server",
@@ -63,7 +69,7 @@ var _ = Describe("Reverse Proxy", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}()
 
-				time.Sleep(1 * time.Second)
+				waitForProxy(proxy)
 				Expect(proxy.addr).ToNot(BeNil())
 
 				tr := &http.Transport{
@@ -160,7 +166,7 @@ var _ = Describe("Reverse Proxy", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}()
 
-				time.Sleep(1 * time.Second)
+				waitForProxy(proxy)
 				Expect(proxy.addr).ToNot(BeNil())
 				proxyBaseAddr := "http://" + proxy.addr.String()
 
@@ -211,7 +217,7 @@ var _ = Describe("Reverse Proxy", func() {
 					Expect(err).ToNot(HaveOccurred())
 				}()
 
-				time.Sleep(1 * time.Second)
+				waitForProxy(proxy)
 				Expect(proxy.addr).ToNot(BeNil())
 				proxyBaseAddr := "http://" + proxy.addr.String()
 
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// ReadyPath is the readiness endpoint of the sidecar
+	ReadyPath = "/ready"
+
+	// LivePath is the liveness endpoint of the sidecar
+	LivePath = "/live"
+
+	// decoderHealthPath is the vLLM health endpoint
+	decoderHealthPath = "/health"
+)
+
+// errDecoderNotProbed is the decoder health until the first probe completes
+var errDecoderNotProbed = errors.New("decoder not probed yet")
+
+// decoderHealth is the result of a decoder probe
+type decoderHealth struct {
+	err error // nil when the decoder is healthy
+}
+
+// readyHandler reports whether the sidecar is ready to serve requests: it is not ready until
+// the SSRF protection allowlist is synced, to avoid rejecting requests with allowed prefillers,
+// nor while the last decoder probe failed.
+func (s *Server) readyHandler(w http.ResponseWriter, _ *http.Request) {
+	if !s.allowlistValidator.Synced() {
+		http.Error(w, "SSRF protection allowlist not synced", http.StatusServiceUnavailable)
+		return
+	}
+	if err := s.decoderHealthError(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// liveHandler reports the sidecar process is alive, regardless of the decoder health
+func (s *Server) liveHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// decoderHealthError returns the error of the last decoder probe, or nil when the decoder is
+// healthy or not probed
+func (s *Server) decoderHealthError() error {
+	if s.currentConfig().DecoderProbeInterval <= 0 {
+		return nil
+	}
+	health := s.decoderHealth.Load()
+	if health == nil {
+		return errDecoderNotProbed
+	}
+	return health.err
+}
+
+// probeDecoder probes the decoder health endpoint every interval until the context is done,
+// caching the result for the readiness endpoint
+func (s *Server) probeDecoder(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := s.checkDecoderHealth(ctx, interval)
+		previous := s.decoderHealth.Swap(&decoderHealth{err: err})
+		switch {
+		case err == nil && (previous == nil || previous.err != nil):
+			s.logger.Info("decoder is ready")
+		case err != nil && (previous == nil || previous.err == nil):
+			s.logger.Info("decoder is not ready", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDecoderHealth sends a request to the decoder health endpoint
+func (s *Server) checkDecoderHealth(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.decoderURL.JoinPath(decoderHealthPath).String(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: s.currentDecoderProxy().Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("decoder not ready: %w", err)
+	}
+	defer resp.Body.Close()        //nolint:all
+	io.Copy(io.Discard, resp.Body) //nolint:all
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("decoder not ready: %s returned %d", decoderHealthPath, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+	"k8s.io/utils/set"
+)
+
+var _ = Describe("Readiness", func() {
+	var (
+		poolSynced atomic.Bool
+		validator  *AllowlistValidator
+		server     *Server
+	)
+
+	BeforeEach(func() {
+		poolSynced.Store(false)
+		validator = &AllowlistValidator{
+			enabled:        true,
+			poolName:       "test-pool",
+			poolSynced:     poolSynced.Load,
+			allowedTargets: map[string]set.Set[string]{"10.0.0.1": set.New("8000")},
+		}
+		server = &Server{allowlistValidator: validator}
+	})
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		server.readyHandler(rec, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+		return rec.Code
+	}
+
+	It("should not be ready until the allowlist is synced", func() {
+		Expect(validator.Synced()).To(BeFalse())
+		Expect(ready()).To(Equal(http.StatusServiceUnavailable))
+
+		poolSynced.Store(true)
+		Expect(validator.Synced()).To(BeTrue())
+		Expect(ready()).To(Equal(http.StatusOK))
+
+		// stays ready once synced
+		poolSynced.Store(false)
+		Expect(validator.Synced()).To(BeTrue())
+	})
+
+	It("should be ready when SSRF protection is disabled", func() {
+		server.allowlistValidator = &AllowlistValidator{}
+		Expect(ready()).To(Equal(http.StatusOK))
+	})
+
+	It("should reject the targets while syncing when failing closed", func() {
+		validator.syncPolicy = AllowlistSyncFailClosed
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.1:8000")).To(BeTrue())
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeFalse())
+	})
+
+	It("should allow all the targets while syncing when failing open", func() {
+		validator.syncPolicy = AllowlistSyncFailOpen
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeTrue())
+
+		poolSynced.Store(true)
+		Expect(validator.IsAllowed(context.Background(), "10.0.0.2:8000")).To(BeFalse())
+	})
+
+	It("should be alive regardless of the allowlist", func() {
+		rec := httptest.NewRecorder()
+		server.liveHandler(rec, httptest.NewRequest(http.MethodGet, LivePath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should not be ready while the decoder is not healthy", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		var decoderStatus atomic.Int32
+		decoderStatus.Store(http.StatusServiceUnavailable)
+		decoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/health"))
+			w.WriteHeader(int(decoderStatus.Load()))
+		}))
+		DeferCleanup(decoder.Close)
+
+		decoderURL, err := url.Parse(decoder.URL)
+		Expect(err).ToNot(HaveOccurred())
+		server, err = NewProxy("0", decoderURL, Config{DecoderProbeInterval: 10 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		server.createRoutes()
+
+		Expect(ready()).To(Equal(http.StatusServiceUnavailable)) // not probed yet
+		go server.probeDecoder(ctx, 10*time.Millisecond)
+		Consistently(ready, 50*time.Millisecond).Should(Equal(http.StatusServiceUnavailable))
+
+		decoderStatus.Store(http.StatusOK)
+		Eventually(ready).Should(Equal(http.StatusOK))
+
+		decoderStatus.Store(http.StatusInternalServerError)
+		Eventually(ready).Should(Equal(http.StatusServiceUnavailable))
+
+		decoder.Close()
+		Consistently(ready, 50*time.Millisecond).Should(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should validate the sync policy", func() {
+		_, err := NewAllowlistValidator(Config{EnableSSRFProtection: true, AllowlistFile: "allowlist", AllowlistSyncPolicy: "unknown"})
+		Expect(err).To(MatchError(ContainSubstring("invalid allowlist sync policy")))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Reconfigure applies a new configuration to the running server, without dropping connections.
+//
+// Only the TLS verification and scheme of outgoing requests, the timeouts, the prefill fallback policy and
+// first token streaming can be changed. The configuration is rejected when any other field differs
+// from the current configuration, since it requires restarting the server.
+func (s *Server) Reconfigure(config Config) error {
+	if config.Connector == "" {
+		config.Connector = ConnectorNIXLV2
+	}
+	if err := config.PrefillFallback.Validate(); err != nil {
+		return fmt.Errorf("invalid prefill fallback policy: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fields := restartRequiredFields(s.config, config); len(fields) > 0 {
+		return fmt.Errorf("changing %s requires a restart", strings.Join(fields, ", "))
+	}
+
+	previous := s.config
+	if previous.PrefillerInsecureSkipVerify != config.PrefillerInsecureSkipVerify {
+		prefillerTLSConfig, err := newPrefillerTLSConfig(config, s.prefillerCert)
+		if err != nil {
+			return err
+		}
+		s.prefillerTLSConfig = prefillerTLSConfig
+	}
+	s.config = config
+
+	// new prefiller proxies are created on demand, with the new configuration
+	if previous.PrefillerUseTLS != config.PrefillerUseTLS ||
+		previous.PrefillerInsecureSkipVerify != config.PrefillerInsecureSkipVerify ||
+		previous.PrefillConnectTimeout != config.PrefillConnectTimeout {
+		s.prefillerProxies.Purge()
+	}
+
+	// in-flight decode requests complete on the previous proxy, whose idle connections are closed
+	if s.decoderProxy != nil && (previous.DecoderInsecureSkipVerify != config.DecoderInsecureSkipVerify ||
+		previous.DecodeFirstByteTimeout != config.DecodeFirstByteTimeout) {
+		if transport, ok := s.decoderProxy.Transport.(*http.Transport); ok {
+			transport.CloseIdleConnections()
+		}
+		s.decoderProxy = s.newDecoderProxy(config)
+	}
+	return nil
+}
+
+// restartRequiredFields returns the names of the fields which differ between the two configurations
+// and cannot be changed on a running server
+func restartRequiredFields(current, config Config) []string {
+	// reset the fields applied live
+	config.PrefillerUseTLS = current.PrefillerUseTLS
+	config.PrefillerInsecureSkipVerify = current.PrefillerInsecureSkipVerify
+	config.DecoderInsecureSkipVerify = current.DecoderInsecureSkipVerify
+	config.PrefillConnectTimeout = current.PrefillConnectTimeout
+	config.PrefillTimeout = current.PrefillTimeout
+	config.DecodeFirstByteTimeout = current.DecodeFirstByteTimeout
+	config.StreamFirstToken = current.StreamFirstToken
+	config.PrefillFallback = current.PrefillFallback
+	config.MaxRequestBodySize = current.MaxRequestBodySize
+
+	var fields []string
+	cv, nv := reflect.ValueOf(current), reflect.ValueOf(config)
+	for i := range cv.NumField() {
+		cf, nf := cv.Field(i), nv.Field(i)
+		if (cf.Kind() == reflect.Map || cf.Kind() == reflect.Slice) && cf.Len() == 0 && nf.Len() == 0 {
+			continue // nil and empty maps or slices are equivalent
+		}
+		if !reflect.DeepEqual(cf.Interface(), nf.Interface()) {
+			fields = append(fields, cv.Type().Field(i).Name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Reconfigure", func() {
+	It("should reject changes requiring a restart", func() {
+		proxy, err := NewProxy("0", &url.URL{}, Config{Connector: ConnectorNIXLV2, MetricsPort: "9090"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(proxy.Reconfigure(Config{Connector: ConnectorNIXLV1, MetricsPort: "9091"})).
+			To(MatchError(ContainSubstring("changing Connector, MetricsPort requires a restart")))
+		Expect(proxy.Reconfigure(Config{MetricsPort: "9090", ConnectorOptions: map[string]string{}})).To(Succeed())
+		Expect(proxy.Reconfigure(Config{MetricsPort: "9090", PrefillFallback: FallbackPolicy{StatusCodes: []string{"abc"}}})).
+			To(HaveOccurred())
+	})
+
+	It("should apply the new configuration to the following requests", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewTLSServer(prefillHandler)
+		DeferCleanup(prefillBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		config := Config{Connector: ConnectorNIXLV2}
+		proxy, err := NewProxy("0", decodeURL, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+
+		sendRequest := func() int {
+			body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+			req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("https://"):])
+
+			rp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rp.Body.Close()).To(Succeed())
+			return rp.StatusCode
+		}
+
+		// plain HTTP request to a TLS prefiller
+		Expect(sendRequest()).To(Equal(http.StatusBadRequest))
+
+		config.PrefillerUseTLS = true
+		config.PrefillerInsecureSkipVerify = true
+		Expect(proxy.Reconfigure(config)).To(Succeed())
+		Expect(sendRequest()).To(Equal(http.StatusOK))
+		Expect(prefillHandler.RequestCount.Load()).To(BeNumerically("==", 1))
+	})
+})
@@ -0,0 +1,52 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// maxRequestIDLength is the maximum length of an incoming request ID
+const maxRequestIDLength = 256
+
+// requestID returns the incoming x-request-id when present and valid, or a newly generated one
+func requestID(r *http.Request) (string, error) {
+	if id := r.Header.Get(requestHeaderRequestID); isValidRequestID(id) {
+		return id, nil
+	}
+
+	id, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// isValidRequestID returns true when id is non-empty, not too long and only made of visible ASCII characters
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
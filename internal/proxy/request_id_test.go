@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Request ID", func() {
+	var (
+		proxyBaseAddr     string
+		prefillRequestIDs []string
+		decodeRequestIDs  []string
+		prefillHostPort   string
+	)
+
+	BeforeEach(func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		prefillRequestIDs, decodeRequestIDs = nil, nil
+
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prefillRequestIDs = r.Header.Values(requestHeaderRequestID)
+			prefillHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(prefillBackend.Close)
+		prefillHostPort = prefillBackend.URL[len("http://"):]
+
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			decodeRequestIDs = r.Header.Values(requestHeaderRequestID)
+			// echo the request ID like vLLM --enable-request-id-headers
+			w.Header().Set(requestHeaderRequestID, r.Header.Get(requestHeaderRequestID))
+			decodeHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		proxyBaseAddr = "http://" + proxy.addr.String()
+	})
+
+	send := func(requestID string, prefill bool) *http.Response {
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if prefill {
+			req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+		}
+		if requestID != "" {
+			req.Header.Add(requestHeaderRequestID, requestID)
+		}
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		return rp
+	}
+
+	It("should reuse the incoming request ID", func() {
+		rp := send("gateway-request-1", true)
+
+		Expect(prefillRequestIDs).To(Equal([]string{"gateway-request-1"}))
+		Expect(decodeRequestIDs).To(Equal([]string{"gateway-request-1"}))
+		Expect(rp.Header.Values(requestHeaderRequestID)).To(Equal([]string{"gateway-request-1"}))
+	})
+
+	It("should generate a request ID when missing", func() {
+		rp := send("", true)
+
+		Expect(prefillRequestIDs).To(HaveLen(1))
+		Expect(prefillRequestIDs[0]).ToNot(BeEmpty())
+		Expect(decodeRequestIDs).To(Equal(prefillRequestIDs))
+		Expect(rp.Header.Values(requestHeaderRequestID)).To(Equal(prefillRequestIDs))
+	})
+
+	It("should replace an invalid request ID", func() {
+		rp := send("invalid request id", false)
+
+		Expect(decodeRequestIDs).To(HaveLen(1))
+		Expect(decodeRequestIDs[0]).ToNot(Equal("invalid request id"))
+		Expect(rp.Header.Values(requestHeaderRequestID)).To(Equal(decodeRequestIDs))
+	})
+})
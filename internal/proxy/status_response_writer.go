@@ -17,15 +17,16 @@ limitations under the License.
 package proxy
 
 import (
+	"bytes"
 	"net/http"
-	"strings"
 )
 
-// bufferedResponseWriter receives responses from prefillers
+// bufferedResponseWriter receives responses from prefillers, in a pooled buffer
 type bufferedResponseWriter struct {
 	headers    http.Header
-	buffer     strings.Builder
+	buffer     *bytes.Buffer // nil until the first write
 	statusCode int
+	err        error // the error returned by the prefiller proxy, if any
 }
 
 func (w *bufferedResponseWriter) Header() http.Header {
@@ -39,9 +40,28 @@ func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
 	if w.statusCode == 0 {
 		w.statusCode = http.StatusOK
 	}
+	if w.buffer == nil {
+		w.buffer = getBuffer()
+	}
 	return w.buffer.Write(b)
 }
 
 func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 }
+
+// Bytes returns the response body, valid until the writer is released
+func (w *bufferedResponseWriter) Bytes() []byte {
+	if w.buffer == nil {
+		return nil
+	}
+	return w.buffer.Bytes()
+}
+
+// release returns the response buffer to the pool
+func (w *bufferedResponseWriter) release() {
+	if w.buffer != nil {
+		putBuffer(w.buffer)
+		w.buffer = nil
+	}
+}
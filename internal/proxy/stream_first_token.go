@@ -0,0 +1,367 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	sseDataPrefix = "data: "
+	sseDone       = "[DONE]"
+
+	requestFieldN           = "n"
+	requestFieldBestOf      = "best_of"
+	requestFieldEcho        = "echo"
+	requestFieldLogprobs    = "logprobs"
+	requestFieldSeed        = "seed"
+	requestFieldTemperature = "temperature"
+)
+
+// streamFirstTokenEligible returns true when the prefiller first token can be streamed to the client
+// before the decoder output.
+//
+// The decoder regenerates the first token from the transferred KV cache, so the prefiller token must be
+// the one the decoder produces: sampling must be either greedy (temperature 0) or seeded. Requests with
+// more than one sequence, echo or logprobs are not eligible.
+func streamFirstTokenEligible(completionRequest *CompletionRequest) bool {
+	var stream, echo bool
+	if _, err := completionRequest.Get(requestFieldStream, &stream); err != nil || !stream {
+		return false
+	}
+	for _, field := range []string{requestFieldN, requestFieldBestOf} {
+		var v *float64
+		if _, err := completionRequest.Get(field, &v); err != nil || v != nil && *v > 1 {
+			return false
+		}
+	}
+	if _, err := completionRequest.Get(requestFieldEcho, &echo); err != nil || echo {
+		return false
+	}
+	var logprobs any
+	if _, err := completionRequest.Get(requestFieldLogprobs, &logprobs); err != nil || logprobs != nil && logprobs != false {
+		return false
+	}
+
+	var seed, temperature *float64
+	if _, err := completionRequest.Get(requestFieldSeed, &seed); err == nil && seed != nil {
+		return true
+	}
+	_, err := completionRequest.Get(requestFieldTemperature, &temperature)
+	return err == nil && temperature != nil && *temperature == 0
+}
+
+// firstTokenStreamWriter streams the prefiller first token to the client as a SSE chunk, then
+// splices in the decoder stream.
+//
+// Decoder chunks are rewritten to carry the prefiller response id. The decoder first token, which
+// duplicates the prefiller one, is removed, so the token counts reported in usage are unchanged. When it
+// differs from the prefiller one, the stream is ended with an error event since the decoder output does not
+// follow the token sent to the client, and the rest of the decoder output is discarded.
+type firstTokenStreamWriter struct {
+	w      http.ResponseWriter
+	header http.Header // the decoder response headers, not sent to the client
+	logger logr.Logger
+
+	chat       bool
+	id         string
+	created    any
+	model      any
+	firstToken string
+
+	statusCode int
+	pending    []byte // incomplete SSE event, or the decoder error body
+	replaced   bool   // whether the decoder first token has been removed
+	mismatched bool   // whether the decoder first token differs from the prefiller one
+}
+
+// newFirstTokenStreamWriter returns a writer streaming the first token found in the prefiller response,
+// or nil when the response does not contain any.
+func newFirstTokenStreamWriter(w http.ResponseWriter, logger logr.Logger, chat bool, prefillerResponse []byte) *firstTokenStreamWriter {
+	var response map[string]any
+	if err := json.Unmarshal(prefillerResponse, &response); err != nil {
+		return nil
+	}
+
+	choices, _ := response["choices"].([]any)
+	if len(choices) == 0 {
+		return nil
+	}
+	choice, _ := choices[0].(map[string]any)
+
+	var token string
+	if chat {
+		message, _ := choice["message"].(map[string]any)
+		token, _ = message["content"].(string)
+	} else {
+		token, _ = choice["text"].(string)
+	}
+	id, _ := response["id"].(string)
+	if token == "" || id == "" {
+		return nil
+	}
+
+	return &firstTokenStreamWriter{
+		w:          w,
+		header:     make(http.Header),
+		logger:     logger,
+		chat:       chat,
+		id:         id,
+		created:    response["created"],
+		model:      response["model"],
+		firstToken: token,
+	}
+}
+
+// writeFirstToken sends the response headers and the first token chunk to the client
+func (sw *firstTokenStreamWriter) writeFirstToken() error {
+	choice := map[string]any{
+		"index":         0,
+		"logprobs":      nil,
+		"finish_reason": nil,
+	}
+	object := "text_completion"
+	if sw.chat {
+		object = "chat.completion.chunk"
+		choice["delta"] = map[string]any{"role": "assistant", "content": sw.firstToken}
+	} else {
+		choice["text"] = sw.firstToken
+	}
+
+	chunk, err := json.Marshal(map[string]any{
+		"id":      sw.id,
+		"object":  object,
+		"created": sw.created,
+		"model":   sw.model,
+		"choices": []any{choice},
+	})
+	if err != nil {
+		return err
+	}
+
+	sw.w.Header().Set("Content-Type", "text/event-stream")
+	sw.w.Header().Set("Cache-Control", "no-cache")
+	sw.w.WriteHeader(http.StatusOK)
+	if err := sw.writeEvent(chunk); err != nil {
+		return err
+	}
+	sw.Flush()
+	return nil
+}
+
+// Header returns the decoder response headers. They are not forwarded since the client
+// response headers have already been sent.
+func (sw *firstTokenStreamWriter) Header() http.Header {
+	return sw.header
+}
+
+func (sw *firstTokenStreamWriter) WriteHeader(statusCode int) {
+	if sw.statusCode == 0 {
+		sw.statusCode = statusCode
+	}
+}
+
+func (sw *firstTokenStreamWriter) Write(b []byte) (int, error) {
+	if sw.statusCode == 0 {
+		sw.statusCode = http.StatusOK
+	}
+
+	if sw.mismatched {
+		// the stream was ended
+		return len(b), nil
+	}
+	sw.pending = append(sw.pending, b...)
+	if sw.statusCode < 200 || sw.statusCode >= 300 {
+		// the error body is sent as a single event by finish
+		return len(b), nil
+	}
+
+	for {
+		end := bytes.Index(sw.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		event := sw.pending[:end]
+		sw.pending = sw.pending[end+2:]
+		if err := sw.processEvent(event); err != nil {
+			return 0, err
+		}
+		if sw.mismatched {
+			sw.pending = nil
+			break
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the buffered data to the client
+func (sw *firstTokenStreamWriter) Flush() {
+	_ = http.NewResponseController(sw.w).Flush() // nolint:all
+}
+
+// finish sends the remaining data. A decoder error is sent as a data event followed by [DONE].
+func (sw *firstTokenStreamWriter) finish() error {
+	defer sw.Flush()
+
+	if sw.mismatched || len(sw.pending) == 0 {
+		return nil
+	}
+	if sw.statusCode >= 200 && sw.statusCode < 300 {
+		return sw.processEvent(bytes.TrimRight(sw.pending, "\n"))
+	}
+
+	if err := sw.writeEvent(bytes.TrimSpace(sw.pending)); err != nil {
+		return err
+	}
+	return sw.writeEvent([]byte(sseDone))
+}
+
+// processEvent rewrites a decoder SSE event and sends it to the client
+func (sw *firstTokenStreamWriter) processEvent(event []byte) error {
+	data, ok := bytes.CutPrefix(event, []byte(sseDataPrefix))
+	if !ok || string(data) == sseDone {
+		return sw.writeRaw(event)
+	}
+
+	chunk, err := ParseCompletionRequest(data)
+	if err != nil {
+		// forward as is
+		return sw.writeRaw(event)
+	}
+
+	keep, err := sw.rewriteChunk(chunk)
+	if err != nil {
+		return err
+	}
+	if sw.mismatched {
+		return sw.writeMismatchError()
+	}
+	if !keep {
+		return nil
+	}
+	return sw.writeEvent(chunk.Bytes())
+}
+
+// rewriteChunk rewrites a decoder chunk in place, keeping the other fields byte for byte.
+// It returns false when the chunk must be dropped.
+func (sw *firstTokenStreamWriter) rewriteChunk(chunk *CompletionRequest) (bool, error) {
+	if err := chunk.Set("id", sw.id); err != nil {
+		return false, err
+	}
+	if sw.created != nil {
+		if err := chunk.Set("created", sw.created); err != nil {
+			return false, err
+		}
+	}
+	if sw.replaced {
+		return true, nil
+	}
+
+	var choices []json.RawMessage
+	if _, err := chunk.Get("choices", &choices); err != nil || len(choices) == 0 {
+		return true, nil
+	}
+	choice, err := ParseCompletionRequest(choices[0])
+	if err != nil {
+		return true, nil
+	}
+	var finishReason, usage any
+	_, _ = choice.Get("finish_reason", &finishReason)
+	_, _ = chunk.Get("usage", &usage)
+	finished := finishReason != nil || usage != nil
+
+	content, field := choice, "text"
+	if sw.chat {
+		var delta json.RawMessage
+		if _, err := choice.Get("delta", &delta); err != nil {
+			return true, nil
+		}
+		if content, err = ParseCompletionRequest(delta); err != nil {
+			return true, nil
+		}
+		field = "content"
+	}
+
+	var token string
+	if _, err := content.Get(field, &token); err != nil || token == "" {
+		// chunks preceding the first token (e.g. the chat role chunk) were already sent with the first token
+		return finished, nil
+	}
+
+	// the decoder first token duplicates the prefiller first token
+	sw.replaced = true
+	rest, ok := strings.CutPrefix(token, sw.firstToken)
+	if !ok {
+		// the decoder did not regenerate the prefiller token: the decoder output cannot be spliced
+		sw.logger.Info("decoder first token differs from the prefiller first token, ending the stream",
+			"prefillerToken", sw.firstToken, "decoderToken", token)
+		firstTokenMismatchTotal.Inc()
+		sw.mismatched = true
+		return false, nil
+	}
+
+	if err := content.Set(field, rest); err != nil {
+		return false, err
+	}
+	content.Delete("role")
+	if sw.chat {
+		if err := choice.Set("delta", json.RawMessage(content.Bytes())); err != nil {
+			return false, err
+		}
+	}
+	choices[0] = choice.Bytes()
+	if err := chunk.Set("choices", choices); err != nil {
+		return false, err
+	}
+	return finished || rest != "", nil
+}
+
+// writeMismatchError ends the stream with an error event, as for a decoder error, followed by [DONE]
+func (sw *firstTokenStreamWriter) writeMismatchError() error {
+	body, err := errorBody(http.StatusBadGateway, errorCodeDecodeFirstTokenMismatch, "",
+		errors.New("the decoder first token differs from the streamed prefiller first token"))
+	if err != nil {
+		return err
+	}
+	if err := sw.writeEvent(body); err != nil {
+		return err
+	}
+	return sw.writeEvent([]byte(sseDone))
+}
+
+// writeEvent sends a data event
+func (sw *firstTokenStreamWriter) writeEvent(data []byte) error {
+	event := make([]byte, 0, len(sseDataPrefix)+len(data))
+	event = append(event, sseDataPrefix...)
+	event = append(event, data...)
+	return sw.writeRaw(event)
+}
+
+// writeRaw sends an event as is
+func (sw *firstTokenStreamWriter) writeRaw(event []byte) error {
+	b := make([]byte, 0, len(event)+2)
+	b = append(b, event...)
+	b = append(b, '\n', '\n')
+	_, err := sw.w.Write(b)
+	return err
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Streaming prefiller first token", func() {
+	const (
+		prefillResponse = `{"id":"chatcmpl-prefill","object":"chat.completion","created":1700000000,"model":"qwen",` +
+			`"choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"length"}],` +
+			`"kv_transfer_params":{"remote_block_ids":[1,2,3],"remote_engine_id":"e","remote_host":"h","remote_port":1}}`
+
+		decodeStream = `data: {"id":"chatcmpl-decode","object":"chat.completion.chunk","created":1700000001,"model":"qwen","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-decode","object":"chat.completion.chunk","created":1700000001,"model":"qwen","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-decode","object":"chat.completion.chunk","created":1700000001,"model":"qwen","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-decode","object":"chat.completion.chunk","created":1700000001,"model":"qwen","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: [DONE]
+
+`
+	)
+
+	var (
+		proxyBaseAddr   string
+		prefillHostPort string
+		stream          string
+	)
+
+	BeforeEach(func() {
+		stream = decodeStream
+
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(prefillResponse)) //nolint:all
+		}))
+		DeferCleanup(prefillBackend.Close)
+		prefillHostPort = prefillBackend.URL[len("http://"):]
+
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			// send the stream in small pieces to exercise the SSE event reassembly
+			for i := 0; i < len(stream); i += 17 {
+				w.Write([]byte(stream[i:min(i+17, len(stream))])) //nolint:all
+			}
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{StreamFirstToken: true})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		proxyBaseAddr = "http://" + proxy.addr.String()
+	})
+
+	send := func(body string) string {
+		req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+ChatCompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillHostPort)
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer rp.Body.Close() //nolint:all
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+
+		b, err := io.ReadAll(rp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("should stream the prefiller first token then splice the decoder stream", func() {
+		out := send(`{"model":"qwen","messages":[{"role":"user","content":"Hi"}],"stream":true,"temperature":0}`)
+
+		events := strings.Split(strings.TrimSpace(out), "\n\n")
+		Expect(events).To(HaveLen(4))
+		Expect(events[0]).To(ContainSubstring(`"delta":{"content":"Hello","role":"assistant"}`))
+		Expect(events[0]).To(ContainSubstring(`"id":"chatcmpl-prefill"`))
+		// the decoder chunks are edited in place, keeping their other fields and order
+		Expect(events[1]).To(Equal(`data: {"id":"chatcmpl-prefill","object":"chat.completion.chunk","created":1700000000,"model":"qwen","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`))
+		Expect(events[2]).To(Equal(`data: {"id":"chatcmpl-prefill","object":"chat.completion.chunk","created":1700000000,"model":"qwen","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+		Expect(events[3]).To(Equal("data: [DONE]"))
+		Expect(out).ToNot(ContainSubstring("chatcmpl-decode"))
+		Expect(out).ToNot(ContainSubstring("1700000001"))
+	})
+
+	It("should end the stream with an error when the decoder first token differs", func() {
+		stream = strings.Replace(decodeStream, `"delta":{"content":"Hello"}`, `"delta":{"content":"Hi"}`, 1)
+		mismatches := testutil.ToFloat64(firstTokenMismatchTotal)
+
+		out := send(`{"model":"qwen","messages":[{"role":"user","content":"Hi"}],"stream":true,"temperature":0}`)
+
+		events := strings.Split(strings.TrimSpace(out), "\n\n")
+		Expect(events).To(HaveLen(3))
+		Expect(events[0]).To(ContainSubstring(`"delta":{"content":"Hello","role":"assistant"}`))
+		data, ok := strings.CutPrefix(events[1], "data: ")
+		Expect(ok).To(BeTrue())
+		Expect(data).To(MatchJSON(`{"object":"error","message":"decode_first_token_mismatch: the decoder first token differs from the streamed prefiller first token","type":"BadGateway","param":null,"code":502}`))
+		Expect(events[2]).To(Equal("data: [DONE]"))
+		Expect(out).ToNot(ContainSubstring("world"))
+		Expect(testutil.ToFloat64(firstTokenMismatchTotal)).To(Equal(mismatches + 1))
+	})
+
+	It("should forward the decoder stream unchanged when sampling is not deterministic", func() {
+		out := send(`{"model":"qwen","messages":[{"role":"user","content":"Hi"}],"stream":true}`)
+		Expect(out).To(Equal(decodeStream))
+	})
+})
+
+var _ = DescribeTable("streamFirstTokenEligible",
+	func(request string, eligible bool) {
+		completionRequest, err := ParseCompletionRequest([]byte(request))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(streamFirstTokenEligible(completionRequest)).To(Equal(eligible))
+	},
+	Entry("greedy streaming", `{"stream": true, "temperature": 0.0}`, true),
+	Entry("seeded streaming", `{"stream": true, "seed": 42}`, true),
+	Entry("large seed", `{"stream": true, "seed": 18446744073709551615}`, true),
+	Entry("not streaming", `{"temperature": 0.0}`, false),
+	Entry("random sampling", `{"stream": true, "temperature": 0.7}`, false),
+	Entry("null seed", `{"stream": true, "seed": null, "temperature": 0.7}`, false),
+	Entry("several sequences", `{"stream": true, "temperature": 0.0, "n": 2}`, false),
+	Entry("logprobs", `{"stream": true, "temperature": 0.0, "logprobs": true}`, false),
+	Entry("echo", `{"stream": true, "temperature": 0.0, "echo": true}`, false),
+)
@@ -0,0 +1,40 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// requestDeadline returns the deadline set by the client in the x-request-deadline header, if any.
+// The deadline is either an RFC 3339 timestamp or a duration relative to now (e.g. "30s").
+func requestDeadline(r *http.Request) (time.Time, bool, error) {
+	value := r.Header.Get(requestHeaderRequestDeadline)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return deadline, true, nil
+	}
+	if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+		return time.Now().Add(timeout), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid %s header %q: expecting an RFC 3339 timestamp or a positive duration", requestHeaderRequestDeadline, value)
+}
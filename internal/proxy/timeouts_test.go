@@ -0,0 +1,169 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("Timeouts", func() {
+	var (
+		ctx           context.Context
+		decodeHandler *mock.ChatCompletionHandler
+		decodeURL     *url.URL
+		slowPrefill   string
+	)
+
+	BeforeEach(func() {
+		_, ctx = ktesting.NewTestContext(GinkgoT())
+		var cancelFn context.CancelFunc
+		ctx, cancelFn = context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		decodeHandler = &mock.ChatCompletionHandler{
+			Connector: ConnectorNIXLV2,
+			Role:      mock.RoleDecode,
+		}
+		decodeBackend := httptest.NewServer(decodeHandler)
+		DeferCleanup(decodeBackend.Close)
+
+		var err error
+		decodeURL, err = url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		// prefiller never answering in time
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(3 * time.Second):
+				prefillHandler.ServeHTTP(w, r)
+			}
+		}))
+		DeferCleanup(prefillBackend.Close)
+		slowPrefill = prefillBackend.URL[len("http://"):]
+	})
+
+	startProxy := func(cfg Config) string {
+		proxy, err := NewProxy("0", decodeURL, cfg) // port 0 to automatically choose one that's available.
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+		return "http://" + proxy.addr.String()
+	}
+
+	sendRequest := func(proxyBaseAddr string, header http.Header) (*http.Response, errorResponse) {
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, proxyBaseAddr+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header = header
+		req.Header.Add(requestHeaderPrefillHostPort, slowPrefill)
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		b, err := io.ReadAll(rp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+
+		var er errorResponse
+		if rp.StatusCode != http.StatusOK {
+			Expect(json.Unmarshal(b, &er)).To(Succeed())
+		}
+		return rp, er
+	}
+
+	It("should return a 504 error when the prefill times out", func() {
+		proxyBaseAddr := startProxy(Config{Connector: ConnectorNIXLV2, PrefillTimeout: 200 * time.Millisecond})
+
+		start := time.Now()
+		rp, er := sendRequest(proxyBaseAddr, http.Header{})
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(rp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		Expect(er.Object).To(Equal("error"))
+		Expect(er.Type).To(Equal("GatewayTimeout"))
+		Expect(er.Code).To(Equal(http.StatusGatewayTimeout))
+		Expect(decodeHandler.CompletionRequests).To(BeEmpty())
+	})
+
+	It("should fall back to local prefill when the prefill times out", func() {
+		proxyBaseAddr := startProxy(Config{
+			Connector:       ConnectorNIXLV2,
+			PrefillTimeout:  200 * time.Millisecond,
+			PrefillFallback: FallbackPolicy{Enabled: true},
+		})
+
+		rp, _ := sendRequest(proxyBaseAddr, http.Header{})
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+		Expect(rp.Header.Get(responseHeaderPrefillFallback)).To(Equal(fallbackReasonTimeout))
+	})
+
+	It("should honor the client deadline", func() {
+		proxyBaseAddr := startProxy(Config{Connector: ConnectorNIXLV2})
+
+		start := time.Now()
+		rp, er := sendRequest(proxyBaseAddr, http.Header{requestHeaderRequestDeadline: []string{"300ms"}})
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+		Expect(rp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		Expect(er.Type).To(Equal("GatewayTimeout"))
+
+		past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+		rp, er = sendRequest(proxyBaseAddr, http.Header{requestHeaderRequestDeadline: []string{past}})
+		Expect(rp.StatusCode).To(Equal(http.StatusGatewayTimeout))
+		Expect(er.Code).To(Equal(http.StatusGatewayTimeout))
+
+		rp, er = sendRequest(proxyBaseAddr, http.Header{requestHeaderRequestDeadline: []string{"tomorrow"}})
+		Expect(rp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(er.Type).To(Equal("BadRequestError"))
+	})
+
+	It("should parse the deadline header", func() {
+		r := httptest.NewRequest(http.MethodPost, CompletionsPath, nil)
+		_, ok, err := requestDeadline(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		r.Header.Set(requestHeaderRequestDeadline, "2030-01-02T03:04:05Z")
+		deadline, ok, err := requestDeadline(r)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(deadline).To(Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)))
+
+		r.Header.Set(requestHeaderRequestDeadline, "-5s")
+		_, _, err = requestDeadline(r)
+		Expect(err).To(HaveOccurred())
+	})
+})
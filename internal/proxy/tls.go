@@ -17,56 +17,336 @@ limitations under the License.
 package proxy
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
+
+	"github.com/go-logr/logr"
 )
 
-// CreateSelfSignedTLSCertificate creates a self-signed cert the server can use to serve TLS.
-// Original code: https://github.com/kubernetes-sigs/gateway-api-inference-extension/blob/8d01161ec48d6b49cd371f179551b35da46e6fd6/internal/tls/tls.go
-func CreateSelfSignedTLSCertificate() (tls.Certificate, error) {
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// The key types of the self-signed certificates
+const (
+	KeyTypeRSA   = "rsa"
+	KeyTypeECDSA = "ecdsa"
+)
+
+const (
+	// defaultSelfSignedValidity is the default validity of the self-signed certificates
+	defaultSelfSignedValidity = 30 * 24 * time.Hour
+
+	// selfSignedCAValidity is the validity of the generated CA
+	selfSignedCAValidity = 10 * 365 * 24 * time.Hour
+
+	selfSignedCACertFile = "ca.crt"
+	selfSignedCAKeyFile  = "ca.key"
+	selfSignedCALockFile = "ca.lock"
+
+	// selfSignedCALockTimeout is how long to wait for another replica generating the CA
+	selfSignedCALockTimeout = 30 * time.Second
+	// selfSignedCALockRetryInterval is how often the CA lock is retried
+	selfSignedCALockRetryInterval = 100 * time.Millisecond
+)
+
+// SelfSignedCertConfig configures the certificate generated when the secure proxy has no certificate path
+type SelfSignedCertConfig struct {
+	// DNSNames and IPAddresses are the SANs of the certificate. They default to the host name and localhost,
+	// and to the IPs of the network interfaces.
+	DNSNames    []string
+	IPAddresses []string
+
+	// KeyType is KeyTypeRSA (the default, 4096 bits) or KeyTypeECDSA (P-256, faster to generate).
+	KeyType string
+
+	// Validity is the validity of the certificate, which is renewed when a third of it remains. Defaults to 30 days.
+	Validity time.Duration
+
+	// CADir is the directory of the CA issuing the certificate, in ca.crt and ca.key. The CA is generated and
+	// written there when missing, so that peers can trust it through a shared CA bundle. The certificate is
+	// self-signed when empty.
+	CADir string
+}
+
+// Validate checks the key type, IPs and validity are valid
+func (c SelfSignedCertConfig) Validate() error {
+	switch c.KeyType {
+	case "", KeyTypeRSA, KeyTypeECDSA:
+	default:
+		return fmt.Errorf("invalid key type %q: expecting %s or %s", c.KeyType, KeyTypeRSA, KeyTypeECDSA)
+	}
+	for _, ip := range c.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address %q", ip)
+		}
+	}
+	if c.Validity < 0 {
+		return fmt.Errorf("invalid validity %s", c.Validity)
+	}
+	return nil
+}
+
+// selfSignedIssuer serves a generated certificate, which is renewed before it expires
+type selfSignedIssuer struct {
+	config      SelfSignedCertConfig
+	dnsNames    []string
+	ipAddresses []net.IP
+
+	ca    *x509.Certificate // the issuer, nil for self-signed certificates
+	caKey crypto.Signer
+
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// newSelfSignedIssuer loads or generates the CA, if any, and issues the first certificate
+func newSelfSignedIssuer(logger logr.Logger, config SelfSignedCertConfig) (*selfSignedIssuer, error) {
+	if config.Validity == 0 {
+		config.Validity = defaultSelfSignedValidity
+	}
+	issuer := &selfSignedIssuer{config: config, dnsNames: config.DNSNames}
+	for _, ip := range config.IPAddresses {
+		issuer.ipAddresses = append(issuer.ipAddresses, net.ParseIP(ip))
+	}
+	if len(issuer.dnsNames) == 0 && len(issuer.ipAddresses) == 0 {
+		issuer.dnsNames, issuer.ipAddresses = defaultSANs()
+	}
+
+	if config.CADir != "" {
+		var err error
+		if issuer.ca, issuer.caKey, err = loadOrCreateCA(logger, config); err != nil {
+			return nil, err
+		}
+	}
+	if err := issuer.issue(logger); err != nil {
+		return nil, err
+	}
+	return issuer, nil
+}
+
+// issue generates a new certificate
+func (i *selfSignedIssuer) issue(logger logr.Logger) error {
+	key, err := generateKey(i.config.KeyType)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("error creating serial number: %v", err)
+		return err
 	}
 	now := time.Now()
-	notBefore := now.UTC()
-	template := x509.Certificate{
-		SerialNumber: serialNumber,
+	template := &x509.Certificate{
 		Subject: pkix.Name{
 			Organization: []string{"llm-d Routing Sidecar"},
 		},
-		NotBefore:             notBefore,
-		NotAfter:              now.Add(time.Hour * 24 * 365 * 10).UTC(), // 10 years
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		NotBefore:             now.Add(-time.Minute).UTC(), // tolerates clock skew
+		NotAfter:              now.Add(i.config.Validity).UTC(),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
+		DNSNames:              i.dnsNames,
+		IPAddresses:           i.ipAddresses,
+	}
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	if len(i.dnsNames) > 0 {
+		template.Subject.CommonName = i.dnsNames[0]
 	}
 
-	priv, err := rsa.GenerateKey(rand.Reader, 4096)
+	parent, parentKey := template, key
+	if i.ca != nil {
+		parent, parentKey = i.ca, i.caKey
+	}
+	der, err := createCertificate(template, parent, key.Public(), parentKey)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("error generating key: %v", err)
+		return err
 	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	i.cert.Store(&tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf})
+	recordCertificateExpiry(logger, certificateServer, leaf)
+	return nil
+}
+
+// renewIfDue issues a new certificate when less than a third of the validity of the current one remains
+func (i *selfSignedIssuer) renewIfDue(logger logr.Logger, now time.Time) (bool, error) {
+	if i.cert.Load().Leaf.NotAfter.Sub(now) > i.config.Validity/3 {
+		return false, nil
+	}
+	return true, i.issue(logger)
+}
+
+// getCertificate implements tls.Config.GetCertificate
+func (i *selfSignedIssuer) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return i.cert.Load(), nil
+}
+
+// defaultSANs returns the host name and localhost, and the IPs of the network interfaces
+func defaultSANs() ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		dnsNames = append([]string{hostname}, dnsNames...)
+	}
+	var ips []net.IP
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+	}
+	return dnsNames, ips
+}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+// loadOrCreateCA loads the CA of the CA directory, or generates it when missing. The generation holds a lock
+// file, so that the replicas sharing the CA directory generate a single CA.
+func loadOrCreateCA(logger logr.Logger, config SelfSignedCertConfig) (*x509.Certificate, crypto.Signer, error) {
+	certPath, keyPath := filepath.Join(config.CADir, selfSignedCACertFile), filepath.Join(config.CADir, selfSignedCAKeyFile)
+	ca, signer, err := loadCA(logger, certPath, keyPath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return ca, signer, err
+	}
+
+	unlock, err := lockCADir(config.CADir)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	// another replica may have generated the CA while waiting for the lock
+	ca, signer, err = loadCA(logger, certPath, keyPath)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return ca, signer, err
+	}
+	for _, path := range []string{certPath, keyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return nil, nil, fmt.Errorf("incomplete CA in %s: %s exists without its pair, remove it to generate a new CA",
+				config.CADir, path)
+		}
+	}
+
+	key, err := generateKey(config.KeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"llm-d Routing Sidecar"},
+			CommonName:   "llm-d Routing Sidecar CA",
+		},
+		NotBefore:             now.Add(-time.Minute).UTC(),
+		NotAfter:              now.Add(selfSignedCAValidity).UTC(),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := createCertificate(template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error marshalling private key: %v", err)
+	}
+
+	// the key is written first, so that a CA certificate is always found with its key
+	if err := writeFileAtomically(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return nil, nil, err
+	}
+	if err := writeFileAtomically(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return nil, nil, err
+	}
+	logger.Info("generated the self-signed certificate CA", "path", certPath, "notAfter", ca.NotAfter)
+	return ca, key, nil
+}
+
+// loadCA loads the CA certificate and key. The error wraps fs.ErrNotExist when either file is missing.
+func loadCA(logger logr.Logger, certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("error creating certificate: %v", err)
+		return nil, nil, fmt.Errorf("failed to load the CA in %s: %w", filepath.Dir(certPath), err)
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported CA key in %s", keyPath)
 	}
+	if !pair.Leaf.IsCA {
+		return nil, nil, fmt.Errorf("the certificate in %s is not a CA", certPath)
+	}
+	if time.Now().After(pair.Leaf.NotAfter) {
+		return nil, nil, fmt.Errorf("the CA in %s expired on %s", certPath, pair.Leaf.NotAfter)
+	}
+	logger.Info("loaded the self-signed certificate CA", "path", certPath, "notAfter", pair.Leaf.NotAfter)
+	return pair.Leaf, signer, nil
+}
 
-	certBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+// generateKey generates a private key of the given type
+func generateKey(keyType string) (crypto.Signer, error) {
+	var (
+		key crypto.Signer
+		err error
+	)
+	if keyType == KeyTypeECDSA {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %v", err)
+	}
+	return key, nil
+}
 
-	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+// createCertificate signs the certificate template with a random serial number
+func createCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, parentKey crypto.Signer) ([]byte, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("error marshalling private key: %v", err)
+		return nil, fmt.Errorf("error creating serial number: %v", err)
 	}
-	keyBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	template.SerialNumber = serialNumber
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %v", err)
+	}
+	return der, nil
+}
 
-	return tls.X509KeyPair(certBytes, keyBytes)
+// writeFileAtomically writes the file through a temporary file, so that readers never see a partial file
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
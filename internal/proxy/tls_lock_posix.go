@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// lockCADir locks the lock file of the CA directory, waiting for another replica holding it. The lock is
+// released by the returned function, or by the kernel when the process exits, so that a sidecar stopped
+// while generating the CA does not block the other replicas.
+func lockCADir(dir string) (func(), error) {
+	path := filepath.Join(dir, selfSignedCALockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the CA directory: %w", err)
+	}
+
+	deadline := time.Now().Add(selfSignedCALockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			// closing the file releases the lock. The file is kept: removing it would let another replica
+			// lock a new file while a replica waiting on this one gets the lock too.
+			return func() { _ = f.Close() }, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) && !errors.Is(err, syscall.EINTR) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock the CA directory: %w", err)
+		}
+		if time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, fmt.Errorf("timed out waiting for the CA lock %s held by another replica", path)
+		}
+		time.Sleep(selfSignedCALockRetryInterval)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// The TLS security profiles, following the OpenShift and Mozilla server side TLS profiles
+const (
+	// TLSProfileOld allows TLS 1.0 and the legacy cipher suites, for old clients
+	TLSProfileOld = "Old"
+	// TLSProfileIntermediate requires TLS 1.2 with ECDHE and AEAD cipher suites. This is the default.
+	TLSProfileIntermediate = "Intermediate"
+	// TLSProfileModern requires TLS 1.3
+	TLSProfileModern = "Modern"
+	// TLSProfileFIPS restricts TLS 1.2 to the FIPS 140 approved ECDHE AES-GCM cipher suites and NIST curves
+	TLSProfileFIPS = "FIPS"
+	// TLSProfileCustom uses the versions, cipher suites and curves set in the profile
+	TLSProfileCustom = "Custom"
+)
+
+// TLSProfile configures the TLS versions, cipher suites and curves of the sidecar listener and of the
+// connections to the decoder and prefillers
+type TLSProfile struct {
+	// Type is one of TLSProfileOld, TLSProfileIntermediate (the default), TLSProfileModern, TLSProfileFIPS
+	// or TLSProfileCustom.
+	Type string
+
+	// MinVersion and MaxVersion are the TLS versions of the Custom profile, e.g. VersionTLS12. MinVersion
+	// defaults to VersionTLS12, and MaxVersion to the highest version supported.
+	MinVersion string
+	MaxVersion string
+
+	// CipherSuites lists the IANA names of the cipher suites of the Custom profile, e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The TLS 1.3 cipher suites are not configurable.
+	// Defaults to the Go defaults.
+	CipherSuites []string
+
+	// Curves lists the key exchange curves of the Custom profile, by preference, e.g. X25519 or CurveP256.
+	// Defaults to the Go defaults.
+	Curves []string
+}
+
+var (
+	intermediateCipherSuites = []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	}
+
+	oldCipherSuites = append(append([]uint16(nil), intermediateCipherSuites...),
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	)
+
+	fipsCipherSuites = []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}
+
+	mozillaCurves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+	fipsCurves    = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+	tlsVersions = map[string]uint16{
+		"VersionTLS10": tls.VersionTLS10,
+		"VersionTLS11": tls.VersionTLS11,
+		"VersionTLS12": tls.VersionTLS12,
+		"VersionTLS13": tls.VersionTLS13,
+	}
+
+	tlsCurves = map[string]tls.CurveID{
+		tls.X25519.String():         tls.X25519,
+		tls.X25519MLKEM768.String(): tls.X25519MLKEM768,
+		tls.CurveP256.String():      tls.CurveP256,
+		tls.CurveP384.String():      tls.CurveP384,
+		tls.CurveP521.String():      tls.CurveP521,
+	}
+)
+
+// Validate checks the profile type, and the versions, cipher suites and curves of the Custom profile
+func (p TLSProfile) Validate() error {
+	_, err := p.resolve()
+	return err
+}
+
+// newTLSConfig returns a TLS configuration with the versions, cipher suites and curves of the profile,
+// which is expected to be valid. The Intermediate profile is used otherwise.
+func (p TLSProfile) newTLSConfig() *tls.Config {
+	tlsConfig, err := p.resolve()
+	if err != nil {
+		tlsConfig, _ = TLSProfile{}.resolve()
+	}
+	return tlsConfig
+}
+
+func (p TLSProfile) resolve() (*tls.Config, error) {
+	if p.Type != TLSProfileCustom && (p.MinVersion != "" || p.MaxVersion != "" || len(p.CipherSuites) > 0 || len(p.Curves) > 0) {
+		return nil, fmt.Errorf("the TLS versions, cipher suites and curves can only be set with the %s profile", TLSProfileCustom)
+	}
+
+	switch p.Type {
+	case TLSProfileOld:
+		return &tls.Config{MinVersion: tls.VersionTLS10, CipherSuites: oldCipherSuites, CurvePreferences: mozillaCurves}, nil //nolint:gosec
+	case "", TLSProfileIntermediate:
+		return &tls.Config{MinVersion: tls.VersionTLS12, CipherSuites: intermediateCipherSuites, CurvePreferences: mozillaCurves}, nil
+	case TLSProfileModern:
+		return &tls.Config{MinVersion: tls.VersionTLS13, CurvePreferences: mozillaCurves}, nil
+	case TLSProfileFIPS:
+		return &tls.Config{MinVersion: tls.VersionTLS12, CipherSuites: fipsCipherSuites, CurvePreferences: fipsCurves}, nil
+	case TLSProfileCustom:
+	default:
+		return nil, fmt.Errorf("invalid TLS profile %q: expecting one of %s, %s, %s, %s or %s", p.Type,
+			TLSProfileOld, TLSProfileIntermediate, TLSProfileModern, TLSProfileFIPS, TLSProfileCustom)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if p.MinVersion != "" {
+		version, ok := tlsVersions[p.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS minimum version %q", p.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if p.MaxVersion != "" {
+		version, ok := tlsVersions[p.MaxVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS maximum version %q", p.MaxVersion)
+		}
+		if version < tlsConfig.MinVersion {
+			return nil, fmt.Errorf("the TLS maximum version %s is lower than the minimum version", p.MaxVersion)
+		}
+		tlsConfig.MaxVersion = version
+	}
+	for _, name := range p.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS cipher suite %q", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+	for _, name := range p.Curves {
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS curve %q", name)
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, curve)
+	}
+	return tlsConfig, nil
+}
+
+// cipherSuiteID returns the ID of the cipher suite with the given IANA name, including the insecure ones
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, suite := range suites {
+			if suite.Name == name {
+				return suite.ID, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"k8s.io/klog/v2/ktesting"
+)
+
+var _ = Describe("TLS profiles", func() {
+	DescribeTable("should configure the versions, cipher suites and curves",
+		func(profile TLSProfile, minVersion, maxVersion uint16, cipherSuites []uint16, curves []tls.CurveID) {
+			Expect(profile.Validate()).To(Succeed())
+			tlsConfig := profile.newTLSConfig()
+			Expect(tlsConfig.MinVersion).To(Equal(minVersion))
+			Expect(tlsConfig.MaxVersion).To(Equal(maxVersion))
+			Expect(tlsConfig.CipherSuites).To(Equal(cipherSuites))
+			Expect(tlsConfig.CurvePreferences).To(Equal(curves))
+		},
+		Entry("default", TLSProfile{}, uint16(tls.VersionTLS12), uint16(0), intermediateCipherSuites, mozillaCurves),
+		Entry("Old", TLSProfile{Type: TLSProfileOld}, uint16(tls.VersionTLS10), uint16(0), oldCipherSuites, mozillaCurves),
+		Entry("Intermediate", TLSProfile{Type: TLSProfileIntermediate}, uint16(tls.VersionTLS12), uint16(0), intermediateCipherSuites, mozillaCurves),
+		Entry("Modern", TLSProfile{Type: TLSProfileModern}, uint16(tls.VersionTLS13), uint16(0), nil, mozillaCurves),
+		Entry("FIPS", TLSProfile{Type: TLSProfileFIPS}, uint16(tls.VersionTLS12), uint16(0), fipsCipherSuites, fipsCurves),
+		Entry("Custom", TLSProfile{
+			Type:         TLSProfileCustom,
+			MinVersion:   "VersionTLS12",
+			MaxVersion:   "VersionTLS12",
+			CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+			Curves:       []string{"CurveP384"},
+		}, uint16(tls.VersionTLS12), uint16(tls.VersionTLS12), []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, []tls.CurveID{tls.CurveP384}),
+		Entry("Custom defaults", TLSProfile{Type: TLSProfileCustom}, uint16(tls.VersionTLS12), uint16(0), nil, nil),
+	)
+
+	DescribeTable("should reject invalid profiles",
+		func(profile TLSProfile, message string) {
+			Expect(profile.Validate()).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unknown type", TLSProfile{Type: "Strict"}, "invalid TLS profile"),
+		Entry("settings without Custom", TLSProfile{Type: TLSProfileModern, MinVersion: "VersionTLS12"}, "only be set with the Custom profile"),
+		Entry("unknown version", TLSProfile{Type: TLSProfileCustom, MinVersion: "TLS1.2"}, "minimum version"),
+		Entry("inverted versions", TLSProfile{Type: TLSProfileCustom, MinVersion: "VersionTLS13", MaxVersion: "VersionTLS12"}, "lower than the minimum"),
+		Entry("unknown cipher suite", TLSProfile{Type: TLSProfileCustom, CipherSuites: []string{"ECDHE-RSA-AES128-GCM-SHA256"}}, "cipher suite"),
+		Entry("unknown curve", TLSProfile{Type: TLSProfileCustom, Curves: []string{"P-256"}}, "curve"),
+	)
+
+	It("should apply the profile to the listener and the decoder connections", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		// the decoder only accepts TLS 1.2
+		decoder := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		decoder.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		decoder.StartTLS()
+		DeferCleanup(decoder.Close)
+		decoderURL, err := url.Parse(decoder.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		proxy, err := NewProxy("0", decoderURL, Config{
+			SecureProxy:               true,
+			DecoderInsecureSkipVerify: true,
+			TLSProfile:                TLSProfile{Type: TLSProfileModern},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			Expect(proxy.Start(ctx)).To(Succeed())
+		}()
+		waitForProxy(proxy)
+		proxyAddr := "https://" + proxy.addr.String()
+
+		get := func(maxVersion uint16) (int, error) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MaxVersion: maxVersion}, //nolint:gosec
+			}}
+			resp, err := client.Get(proxyAddr + "/v1/models")
+			if err != nil {
+				return 0, err
+			}
+			resp.Body.Close() //nolint:all
+			return resp.StatusCode, nil
+		}
+
+		_, err = get(tls.VersionTLS12)
+		Expect(err).To(MatchError(ContainSubstring("protocol version")))
+
+		// the listener accepts TLS 1.3, but the decoder connection fails
+		Expect(get(tls.VersionTLS13)).To(Equal(http.StatusBadGateway))
+	})
+
+	It("should reject invalid profiles", func() {
+		_, err := NewProxy("0", &url.URL{Scheme: "http", Host: "localhost:8001"}, Config{TLSProfile: TLSProfile{Type: "Strict"}})
+		Expect(err).To(MatchError(ContainSubstring("invalid TLS profile")))
+	})
+})
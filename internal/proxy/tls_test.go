@@ -0,0 +1,181 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+)
+
+var _ = Describe("Self-signed certificates", func() {
+	It("should issue an ECDSA certificate with the configured SANs", func() {
+		issuer, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{
+			DNSNames:    []string{"decode.llm-d.svc"},
+			IPAddresses: []string{"10.0.0.1"},
+			KeyType:     KeyTypeECDSA,
+			Validity:    time.Hour,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		cert := issuer.cert.Load()
+		Expect(cert.PrivateKey).To(BeAssignableToTypeOf(&ecdsa.PrivateKey{}))
+		Expect(cert.Leaf.DNSNames).To(Equal([]string{"decode.llm-d.svc"}))
+		Expect(cert.Leaf.IPAddresses).To(HaveLen(1))
+		Expect(cert.Leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.1"))).To(BeTrue())
+		Expect(cert.Leaf.NotAfter).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+		Expect(cert.Leaf.VerifyHostname("decode.llm-d.svc")).To(Succeed())
+	})
+
+	It("should default to the host name and the interface IPs", func() {
+		issuer, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA})
+		Expect(err).ToNot(HaveOccurred())
+		leaf := issuer.cert.Load().Leaf
+		Expect(leaf.VerifyHostname("localhost")).To(Succeed())
+		Expect(leaf.VerifyHostname("127.0.0.1")).To(Succeed())
+		hostname, err := os.Hostname()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leaf.VerifyHostname(hostname)).To(Succeed())
+		Expect(leaf.NotAfter).To(BeTemporally("~", time.Now().Add(defaultSelfSignedValidity), time.Minute))
+	})
+
+	It("should renew the certificate when a third of its validity remains", func() {
+		issuer, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA, Validity: 3 * time.Hour})
+		Expect(err).ToNot(HaveOccurred())
+		first := issuer.cert.Load()
+
+		Expect(issuer.renewIfDue(logr.Discard(), time.Now().Add(time.Hour))).To(BeFalse())
+		Expect(issuer.cert.Load()).To(BeIdenticalTo(first))
+
+		Expect(issuer.renewIfDue(logr.Discard(), time.Now().Add(2*time.Hour+time.Minute))).To(BeTrue())
+		Expect(issuer.cert.Load().Leaf.SerialNumber).ToNot(Equal(first.Leaf.SerialNumber))
+	})
+
+	It("should persist the generated CA and reuse it", func() {
+		dir := GinkgoT().TempDir()
+		config := SelfSignedCertConfig{DNSNames: []string{"decode"}, KeyType: KeyTypeECDSA, CADir: dir}
+		first, err := newSelfSignedIssuer(logr.Discard(), config)
+		Expect(err).ToNot(HaveOccurred())
+		info, err := os.Stat(filepath.Join(dir, selfSignedCAKeyFile))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+		second, err := newSelfSignedIssuer(logr.Discard(), config)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second.ca.Equal(first.ca)).To(BeTrue())
+
+		// peers trust the certificates through the CA bundle
+		bundle, err := os.ReadFile(filepath.Join(dir, selfSignedCACertFile))
+		Expect(err).ToNot(HaveOccurred())
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(bundle)).To(BeTrue())
+		for _, issuer := range []*selfSignedIssuer{first, second} {
+			_, err := issuer.cert.Load().Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "decode"})
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("should generate a single CA for the replicas sharing the CA directory", func() {
+		dir := GinkgoT().TempDir()
+		config := SelfSignedCertConfig{DNSNames: []string{"decode"}, KeyType: KeyTypeECDSA, CADir: dir}
+
+		issuers := make([]*selfSignedIssuer, 4)
+		var wg sync.WaitGroup
+		for i := range issuers {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				var err error
+				issuers[i], err = newSelfSignedIssuer(logr.Discard(), config)
+				Expect(err).ToNot(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		for _, issuer := range issuers[1:] {
+			Expect(issuer.ca.Equal(issuers[0].ca)).To(BeTrue())
+		}
+	})
+
+	It("should wait for the replica holding the CA lock", func() {
+		dir := GinkgoT().TempDir()
+		unlock, err := lockCADir(dir)
+		Expect(err).ToNot(HaveOccurred())
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			_, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA, CADir: dir})
+			Expect(err).ToNot(HaveOccurred())
+		}()
+		Consistently(done, 300*time.Millisecond).ShouldNot(BeClosed())
+
+		unlock()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("should not be blocked by the lock file of a stopped replica", func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, selfSignedCALockFile), nil, 0o600)).To(Succeed())
+		_, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA, CADir: dir})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Join(dir, selfSignedCACertFile)).To(BeAnExistingFile())
+	})
+
+	DescribeTable("should reject an incomplete CA",
+		func(file string) {
+			dir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(dir, file), []byte("partial"), 0o600)).To(Succeed())
+			_, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA, CADir: dir})
+			Expect(err).To(MatchError(ContainSubstring("incomplete CA")))
+
+			// nothing is written but the lock file
+			entries, err := os.ReadDir(dir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(filepath.Join(dir, selfSignedCALockFile)).To(BeAnExistingFile())
+		},
+		Entry("certificate without key", selfSignedCACertFile),
+		Entry("key without certificate", selfSignedCAKeyFile),
+	)
+
+	It("should reject an invalid CA", func() {
+		dir := GinkgoT().TempDir()
+		_, certFile, keyFile := newTestCA().issue("leaf", []string{"leaf"}, nil)
+		Expect(os.Rename(certFile, filepath.Join(dir, selfSignedCACertFile))).To(Succeed())
+		Expect(os.Rename(keyFile, filepath.Join(dir, selfSignedCAKeyFile))).To(Succeed())
+		_, err := newSelfSignedIssuer(logr.Discard(), SelfSignedCertConfig{KeyType: KeyTypeECDSA, CADir: dir})
+		Expect(err).To(MatchError(ContainSubstring("not a CA")))
+	})
+
+	It("should validate the configuration", func() {
+		Expect(SelfSignedCertConfig{KeyType: "dsa"}.Validate()).To(MatchError(ContainSubstring("key type")))
+		Expect(SelfSignedCertConfig{IPAddresses: []string{"decode"}}.Validate()).To(MatchError(ContainSubstring("IP address")))
+		Expect(SelfSignedCertConfig{Validity: -time.Hour}.Validate()).To(MatchError(ContainSubstring("validity")))
+		Expect(SelfSignedCertConfig{KeyType: KeyTypeECDSA, IPAddresses: []string{"::1"}}.Validate()).To(Succeed())
+	})
+})
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/llm-d/llm-d-routing-sidecar/internal/proxy"
+
+	spanNameRequest = "llm_d.routing_sidecar.request"
+	spanNamePrefill = "llm_d.routing_sidecar.prefill"
+	spanNameDecode  = "llm_d.routing_sidecar.decode"
+
+	attributeConnector    = attribute.Key("llm_d.connector")
+	attributeOutcome      = attribute.Key("llm_d.outcome")
+	attributeKVBlockCount = attribute.Key("llm_d.kv.block_count")
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// extractTraceContext returns the context carrying the trace context of the incoming request
+func extractTraceContext(r *http.Request) context.Context {
+	return otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
+// injectTraceContext propagates the span context of ctx (W3C traceparent) to the outgoing request
+func injectTraceContext(ctx context.Context, r *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+}
+
+// kvBlockCount returns the number of KV blocks reported by the prefiller, or -1 when unknown
+func kvBlockCount(prefillState map[string]any) int {
+	params := prefillState
+	switch kvTransferParams := prefillState[requestFieldKVTransferParams].(type) {
+	case map[string]any:
+		params = kvTransferParams
+	case json.RawMessage:
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(kvTransferParams, &raw); err != nil {
+			return -1
+		}
+		params = map[string]any{requestFieldRemoteBlockIDs: raw[requestFieldRemoteBlockIDs]}
+	}
+	switch blockIDs := params[requestFieldRemoteBlockIDs].(type) {
+	case []any:
+		return len(blockIDs)
+	case json.RawMessage:
+		var ids []json.RawMessage
+		if err := json.Unmarshal(blockIDs, &ids); err != nil || ids == nil {
+			return -1
+		}
+		return len(ids)
+	}
+	return -1
+}
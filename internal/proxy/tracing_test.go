@@ -0,0 +1,179 @@
+/*
+Copyright 2025 The llm-d Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/llm-d/llm-d-routing-sidecar/internal/tracing"
+	"github.com/llm-d/llm-d-routing-sidecar/test/mock"
+	. "github.com/onsi/ginkgo/v2" // nolint:revive
+	. "github.com/onsi/gomega"    // nolint:revive
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2/ktesting"
+)
+
+// otlpCollector is an in-process OTLP/HTTP trace collector
+type otlpCollector struct {
+	mu    sync.Mutex
+	spans []*tracev1.Span
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close() //nolint:all
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var request collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(b, &request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, rs := range request.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			c.spans = append(c.spans, ss.GetSpans()...)
+		}
+	}
+	c.mu.Unlock()
+
+	b, _ = proto.Marshal(&collectortrace.ExportTraceServiceResponse{}) //nolint:all
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(b) //nolint:all
+}
+
+func (c *otlpCollector) span(name string) *tracev1.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.GetName() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func spanAttribute(span *tracev1.Span, key string) any {
+	for _, kv := range span.GetAttributes() {
+		if kv.GetKey() == key {
+			switch v := kv.GetValue().GetValue().(type) {
+			case *commonv1.AnyValue_StringValue:
+				return v.StringValue
+			case *commonv1.AnyValue_IntValue:
+				return v.IntValue
+			}
+		}
+	}
+	return nil
+}
+
+var _ = Describe("Tracing", func() {
+	It("should export a request span with prefill and decode child spans and propagate traceparent", func() {
+		_, ctx := ktesting.NewTestContext(GinkgoT())
+		ctx, cancelFn := context.WithCancel(ctx)
+		DeferCleanup(cancelFn)
+
+		collector := &otlpCollector{}
+		collectorBackend := httptest.NewServer(collector)
+		DeferCleanup(collectorBackend.Close)
+
+		Expect(os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collectorBackend.URL)).To(Succeed())
+		DeferCleanup(os.Unsetenv, "OTEL_EXPORTER_OTLP_ENDPOINT")
+
+		shutdown, err := tracing.Setup(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+		var prefillTraceParent, decodeTraceParent string
+		prefillHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RolePrefill}
+		prefillBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			prefillTraceParent = r.Header.Get("traceparent")
+			prefillHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(prefillBackend.Close)
+		decodeHandler := &mock.ChatCompletionHandler{Connector: ConnectorNIXLV2, Role: mock.RoleDecode}
+		decodeBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			decodeTraceParent = r.Header.Get("traceparent")
+			decodeHandler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(decodeBackend.Close)
+
+		decodeURL, err := url.Parse(decodeBackend.URL)
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err := NewProxy("0", decodeURL, Config{})
+		Expect(err).ToNot(HaveOccurred())
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := proxy.Start(ctx)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		waitForProxy(proxy)
+		Expect(proxy.addr).ToNot(BeNil())
+
+		const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		body := `{"model": "Qwen/Qwen2-0.5B", "prompt": "Hello", "max_tokens": 50}`
+		req, err := http.NewRequest(http.MethodPost, "http://"+proxy.addr.String()+CompletionsPath, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Add(requestHeaderPrefillHostPort, prefillBackend.URL[len("http://"):])
+		req.Header.Add("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+		rp, err := http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rp.Body.Close()).To(Succeed())
+		Expect(rp.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(shutdown(ctx)).To(Succeed())
+
+		requestSpan := collector.span(spanNameRequest)
+		prefillSpan := collector.span(spanNamePrefill)
+		decodeSpan := collector.span(spanNameDecode)
+		Expect(requestSpan).ToNot(BeNil())
+		Expect(prefillSpan).ToNot(BeNil())
+		Expect(decodeSpan).ToNot(BeNil())
+
+		Expect(requestSpan.GetTraceId()).To(HaveLen(16))
+		Expect(prefillSpan.GetParentSpanId()).To(Equal(requestSpan.GetSpanId()))
+		Expect(decodeSpan.GetParentSpanId()).To(Equal(requestSpan.GetSpanId()))
+		Expect(spanAttribute(requestSpan, string(attributeOutcome))).To(Equal(outcomeDisaggregated))
+		Expect(spanAttribute(prefillSpan, "server.address")).To(Equal(prefillBackend.URL[len("http://"):]))
+		Expect(spanAttribute(prefillSpan, "http.response.status_code")).To(BeNumerically("==", http.StatusOK))
+		Expect(spanAttribute(prefillSpan, string(attributeKVBlockCount))).To(BeNumerically("==", 3))
+
+		Expect(prefillTraceParent).To(HavePrefix("00-" + traceID + "-"))
+		Expect(decodeTraceParent).To(HavePrefix("00-" + traceID + "-"))
+		Expect(prefillTraceParent).ToNot(Equal(decodeTraceParent))
+	})
+})